@@ -2,10 +2,18 @@ package main
 
 import (
 	"bitespeed-identity-reconciliation/internal/database"
-	"bitespeed-identity-reconciliation/internal/handlers"
+	"bitespeed-identity-reconciliation/internal/normalize"
+	"bitespeed-identity-reconciliation/internal/server"
+	"bitespeed-identity-reconciliation/internal/services"
+	"context"
+	"errors"
+	"fmt"
 	"log"
-	"net/http"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/joho/godotenv"
 )
@@ -16,32 +24,173 @@ func main() {
 		log.Println("No .env file found, using default values")
 	}
 
-	log.Println("Starting Bitespeed Identity Reconciliation Service...")
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		return
+	}
 
-	if err := database.InitDB(); err != nil {
-		log.Fatal("Failed to initialize database:", err)
+	if err := serve(); err != nil {
+		log.Fatal(err)
 	}
-	defer database.CloseDB()
+}
 
-	identifyHandler := handlers.NewIdentifyHandler()
+// serve runs the API until SIGINT or SIGTERM, then drains it and closes the
+// store. Render sends SIGTERM on every deploy.
+func serve() error {
+	log.Println("Starting Bitespeed Identity Reconciliation Service...")
 
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+	erasureKey := []byte(os.Getenv("ERASURE_HASH_KEY"))
+	switch {
+	case len(erasureKey) == 0:
+		log.Println("ERASURE_HASH_KEY is not set, identity erasure is disabled")
+	case len(erasureKey) < services.MinErasureKeyLength:
+		return fmt.Errorf("ERASURE_HASH_KEY must be at least %d bytes", services.MinErasureKeyLength)
+	}
 
-	http.HandleFunc("/identify", identifyHandler.Identify)
+	store, closeStore, err := openStore(database.PathFromEnv())
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	identityService := services.NewIdentityService(
+		store,
+		normalize.FromEnv(),
+		erasureKey,
+	)
+	cfg := server.ConfigFromEnv()
+	if len(cfg.AdminTokens) == 0 {
+		log.Println("ADMIN_TOKENS is not set, admin routes are disabled")
+	}
+	router := server.NewRouter(identityService, cfg)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	srv := server.New(":"+port, router, cfg)
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		closeStore()
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
 	log.Printf("Server is running on port %s", port)
 	log.Println("Available endpoints:")
 	log.Println("  GET  /health   - Health check")
 	log.Println("  POST /identify - Identity reconciliation")
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal("Failed to start server:", err)
+	log.Println("  POST /identify/lookup - Identity reconciliation without writes")
+	log.Println("  POST /identify/batch - Identity reconciliation for many requests")
+	log.Println("  GET  /contacts/{id} - Consolidated identity of a contact")
+	log.Println("  DELETE /contacts/{id} - Soft-delete a contact")
+	log.Println("  GET  /contacts/{id}/history - Link history of a contact")
+	log.Println("  POST /identities/merge - Merge two identities by hand (admin)")
+	log.Println("  POST /identities/{primaryId}/erase - Permanently erase an identity (admin)")
+	log.Println("  POST /identities/{primaryId}/split - Detach contacts into a separate identity (admin)")
+	log.Println("  POST /merges/{mergeId}/revert - Undo a merge (admin)")
+	log.Println("  GET  /blocklist - List identifiers that never link contacts (admin)")
+	log.Println("  POST /blocklist - Blocklist an email or phone number (admin)")
+	log.Println("  DELETE /blocklist/{id} - Remove a blocklist entry (admin)")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := server.Serve(ctx, srv, listener, identityService, cfg.ShutdownTimeout)
+	// A transaction still open after a failed drain would be cut off by
+	// closing the store, so it is left to close with the process.
+	if serveErr != nil && ctx.Err() != nil {
+		return fmt.Errorf("shutdown incomplete: %w", serveErr)
+	}
+	if err := closeStore(); err != nil {
+		return errors.Join(serveErr, fmt.Errorf("failed to close database: %w", err))
+	}
+	if serveErr != nil {
+		return serveErr
+	}
+
+	log.Println("Server stopped")
+	return nil
+}
+
+// memoryPath is the DB_PATH that keeps contacts in process memory instead
+// of a database. They are lost when the server stops.
+const memoryPath = "memory://"
+
+// openStore opens the contact store named by path and returns it with the
+// function that closes it.
+func openStore(path string) (services.ContactStore, func() error, error) {
+	if path == memoryPath {
+		log.Println("Using the in-memory store, contacts will not survive a restart")
+		return services.NewMemoryStore(), func() error { return nil }, nil
+	}
+
+	db, err := database.InitDB(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return services.NewSQLStore(database.NewContactRepository(db)), db.Close, nil
+}
+
+// runMigrate implements the migrate subcommand:
+//
+//	server migrate status          print the current and latest schema version
+//	server migrate up [version]    apply migrations up to version, or all
+//	server migrate down [version]  roll back to version, or by one
+func runMigrate(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: migrate status | up [version] | down [version]")
+	}
+
+	path := database.PathFromEnv()
+	if path == memoryPath {
+		return fmt.Errorf("%s has no schema to migrate", memoryPath)
+	}
+
+	db, err := database.Open(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	current, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	target := -1
+	if len(args) == 2 {
+		if target, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+	}
+
+	switch args[0] {
+	case "status":
+		log.Printf("Schema version %d, latest %d", current, database.LatestSchemaVersion())
+		return nil
+	case "up":
+		if target < 0 {
+			target = database.LatestSchemaVersion()
+		}
+		if target < current {
+			return fmt.Errorf("version %d is older than the current version %d, use down", target, current)
+		}
+	case "down":
+		if target < 0 {
+			target = current - 1
+		}
+		if target < 0 || target > current {
+			return fmt.Errorf("cannot roll back from version %d to %d", current, target)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	if err := database.MigrateTo(db, target); err != nil {
+		return err
 	}
+	log.Printf("Schema version %d", target)
+	return nil
 }
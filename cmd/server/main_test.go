@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"bitespeed-identity-reconciliation/internal/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServe_DrainsOnSIGTERM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.db")
+	t.Setenv("DB_PATH", path)
+	port := strconv.Itoa(freePort(t))
+	t.Setenv("PORT", port)
+	t.Setenv("SHUTDOWN_TIMEOUT", "10s")
+	baseURL := "http://127.0.0.1:" + port
+
+	done := make(chan error, 1)
+	go func() { done <- serve() }()
+	waitForHealth(t, baseURL, done)
+
+	// A streamed batch stays in flight for as long as its body is open, so
+	// the signal is sure to arrive mid-request.
+	body, bodyWriter := io.Pipe()
+	writeRequests := func(from, to int) {
+		for i := from; i < to; i++ {
+			fmt.Fprintf(bodyWriter, `{"email": "user%d@example.com", "phoneNumber": "55500%d"}`+"\n", i, i)
+		}
+	}
+	go writeRequests(0, 3)
+
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/identify/batch", body)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Batch request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to send SIGTERM: %v", err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Expected serve to wait for the batch, it returned %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	writeRequests(3, 5)
+	bodyWriter.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	results := 0
+	for {
+		var result models.BatchIdentifyResult
+		if err := decoder.Decode(&result); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Failed to read results: %v", err)
+		}
+		if result.Status != http.StatusOK {
+			t.Errorf("Expected request %d to succeed, got %+v", result.Index, result)
+		}
+		results++
+	}
+	if results != 5 {
+		t.Errorf("Expected 5 results, got %d", results)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve did not return after SIGTERM")
+	}
+
+	// The store was closed cleanly, with every write of the batch in it.
+	db, err := database.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	var contacts int
+	if err := db.QueryRow("SELECT COUNT(*) FROM contacts").Scan(&contacts); err != nil {
+		t.Fatalf("Failed to count contacts: %v", err)
+	}
+	if contacts != 5 {
+		t.Errorf("Expected 5 contacts, got %d", contacts)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// waitForHealth waits until the server answers its health check.
+func waitForHealth(t *testing.T, baseURL string, done <-chan error) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-done:
+			t.Fatalf("serve returned before the server was up: %v", err)
+		default:
+		}
+		if resp, err := http.Get(baseURL + "/health"); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Server did not come up")
+}
@@ -1,75 +1,116 @@
 package database
 
 import (
+	"bitespeed-identity-reconciliation/internal/normalize"
 	"database/sql"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strings"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var (
-	DB          *sql.DB
-	ContactRepo *ContactRepository
-)
-
-func InitDB() error {
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./contacts.db"
+// PathFromEnv returns the database from DB_PATH, then DATABASE_URL, or the
+// default SQLite file. Either may hold a SQLite path or a postgres:// DSN.
+func PathFromEnv() string {
+	if path := os.Getenv("DB_PATH"); path != "" {
+		return path
+	}
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		return url
 	}
+	return "./contacts.db"
+}
 
-	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
+// InitDB opens the database at path, brings its schema up to date,
+// repairs data written by older versions and normalizes stored identifiers
+// again if the normalizer configuration changed.
+func InitDB(path string) (*sql.DB, error) {
+	db, err := Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err = DB.Ping(); err != nil {
-		return err
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	log.Println("Database connected successfully")
-	if err := createTables(); err != nil {
-		return err
+	if err := Migrate(db); err != nil {
+		log.Printf("Error migrating database: %v", err)
+		db.Close()
+		return nil, err
 	}
 
-	ContactRepo = NewContactRepository(DB)
+	repo := NewContactRepository(db)
+
+	flattened, err := repo.FlattenLinkChains()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if flattened > 0 {
+		log.Printf("Re-linked %d contacts from multi-hop chains to their primary", flattened)
+	}
 
-	return nil
+	normalized, err := repo.Renormalize(normalize.FromEnv())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if normalized > 0 {
+		log.Printf("Normalized identifiers of %d existing contacts", normalized)
+	}
+
+	return db, nil
 }
 
-func createTables() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS contacts (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        phone_number TEXT,
-        email TEXT,
-        linked_id INTEGER,
-        link_precedence TEXT NOT NULL CHECK(link_precedence IN ('primary', 'secondary')),
-        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-        deleted_at DATETIME,
-        FOREIGN KEY (linked_id) REFERENCES contacts(id)
-    );
-
-    CREATE INDEX IF NOT EXISTS idx_phone ON contacts(phone_number) WHERE deleted_at IS NULL;
-    CREATE INDEX IF NOT EXISTS idx_email ON contacts(email) WHERE deleted_at IS NULL;
-    CREATE INDEX IF NOT EXISTS idx_linked_id ON contacts(linked_id) WHERE deleted_at IS NULL;
-    `
-	_, err := DB.Exec(query)
+// Open opens the PostgreSQL database named by a postgres:// DSN, or else
+// the SQLite database at path, which may carry its own query string.
+// SQLite transactions are started with BEGIN IMMEDIATE so a reconciliation
+// holds the write lock from its first read, and concurrent writers wait on
+// the busy timeout instead of failing with SQLITE_BUSY. PostgreSQL
+// transactions run side by side and lock what they touch with LockKeys or
+// LockAll.
+func Open(path string) (*sql.DB, error) {
+	if IsPostgresDSN(path) {
+		return sql.Open("postgres", path)
+	}
+
+	dsn, err := sqliteDSN(path)
 	if err != nil {
-		log.Printf("Error creating tables: %v", err)
-		return err
+		return nil, err
 	}
+	return sql.Open("sqlite3", dsn)
+}
 
-	log.Println("Database tables created successfully")
-	return nil
+// sqliteDefaults are the connection parameters of every SQLite database.
+// The transaction lock is always immediate; the others may be overridden
+// in DB_PATH.
+var sqliteDefaults = url.Values{
+	"_busy_timeout": {"10000"},
+	"_journal_mode": {"WAL"},
 }
 
-func CloseDB() error {
-	if DB != nil {
-		return DB.Close()
+// sqliteDSN adds the connection parameters to path, merging them with any
+// query string it already has, such as "file:contacts.db?cache=shared".
+func sqliteDSN(path string) (string, error) {
+	file, query, _ := strings.Cut(path, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid parameters in database path %q: %w", path, err)
+	}
+
+	for key, value := range sqliteDefaults {
+		if !params.Has(key) {
+			params[key] = value
+		}
 	}
-	return nil
+	params.Set("_txlock", "immediate")
+
+	return file + "?" + params.Encode(), nil
 }
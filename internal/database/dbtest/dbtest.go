@@ -0,0 +1,157 @@
+// Package dbtest provides fresh, migrated databases for tests.
+//
+// Tests run against SQLite by default. When TEST_POSTGRES_DSN names a
+// PostgreSQL server, every database is instead a new schema on that server,
+// dropped when the test ends, so the same suites cover both backends:
+//
+//	TEST_POSTGRES_DSN=postgres://postgres@localhost/postgres?sslmode=disable go test ./...
+package dbtest
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+var schemas atomic.Int64
+
+// DSN returns the DB_PATH of a new, empty database.
+func DSN(t testing.TB) string {
+	t.Helper()
+
+	server := os.Getenv("TEST_POSTGRES_DSN")
+	if server == "" {
+		return filepath.Join(t.TempDir(), "contacts.db")
+	}
+
+	admin, err := sql.Open("postgres", server)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", server, err)
+	}
+	defer admin.Close()
+
+	schema := fmt.Sprintf("test_%d_%d", os.Getpid(), schemas.Add(1))
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("Failed to create schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		admin, err := sql.Open("postgres", server)
+		if err != nil {
+			return
+		}
+		defer admin.Close()
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+	})
+
+	dsn, err := url.Parse(server)
+	if err != nil {
+		t.Fatalf("TEST_POSTGRES_DSN must be a postgres:// URL: %v", err)
+	}
+	query := dsn.Query()
+	query.Set("search_path", schema)
+	dsn.RawQuery = query.Encode()
+	return dsn.String()
+}
+
+// Open returns a new database migrated to the latest schema version.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+
+	db, err := database.Open(DSN(t))
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// Exec runs a seed script. On PostgreSQL, rows inserted with explicit IDs do
+// not advance the ID sequences, so they are moved past the highest ID in use
+// to keep later inserts from colliding.
+func Exec(t testing.TB, db *sql.DB, query string) {
+	t.Helper()
+
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("Failed to execute SQL: %v", err)
+	}
+	if database.DialectOf(db) != database.Postgres {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT table_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND column_name = 'id' AND column_default LIKE 'nextval%'
+	`)
+	if err != nil {
+		t.Fatalf("Failed to list sequences: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("Failed to list sequences: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		_, err := db.Exec(fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s`, table))
+		if err != nil {
+			t.Fatalf("Failed to reset the %s sequence: %v", table, err)
+		}
+	}
+}
+
+// FailOn installs a trigger that aborts every event ("INSERT" or "UPDATE")
+// on table for which the SQL condition holds, or every event if condition
+// is empty. Tests use it to make a write fail half-way through a
+// transaction.
+func FailOn(t testing.TB, db *sql.DB, event, table, condition string) {
+	t.Helper()
+
+	name := "fail_" + strings.ToLower(event) + "_" + table
+	var script string
+	if database.DialectOf(db) == database.Postgres {
+		if condition == "" {
+			condition = "TRUE"
+		}
+		script = fmt.Sprintf(`
+			CREATE FUNCTION %[1]s() RETURNS trigger LANGUAGE plpgsql AS $$
+			BEGIN
+				IF %[4]s THEN
+					RAISE EXCEPTION 'injected failure';
+				END IF;
+				RETURN NEW;
+			END
+			$$;
+			CREATE TRIGGER %[1]s BEFORE %[2]s ON %[3]s FOR EACH ROW EXECUTE FUNCTION %[1]s();
+		`, name, event, table, condition)
+	} else {
+		when := ""
+		if condition != "" {
+			when = "WHEN " + condition
+		}
+		script = fmt.Sprintf(`
+			CREATE TRIGGER %s BEFORE %s ON %s %s
+			BEGIN
+				SELECT RAISE(ABORT, 'injected failure');
+			END;
+		`, name, event, table, when)
+	}
+
+	if _, err := db.Exec(script); err != nil {
+		t.Fatalf("Failed to install %s: %v", name, err)
+	}
+}
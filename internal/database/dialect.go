@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Dialect identifies the SQL flavour spoken by a database.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// DialectOf returns the dialect of an open database, judged by its driver.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*pq.Driver); ok {
+		return Postgres
+	}
+	return SQLite
+}
+
+// IsConflict reports whether err is PostgreSQL aborting a transaction to
+// break a deadlock with a concurrent one, or because it could not be
+// serialized. Such a transaction can be run again from the start.
+func IsConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40P01" || pqErr.Code == "40001")
+}
+
+// IsPostgresDSN reports whether a DB_PATH names a PostgreSQL server rather
+// than a SQLite file.
+func IsPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// rebind rewrites the ? placeholders the repository is written with into
+// the numbered $1, $2, ... form PostgreSQL expects. Question marks inside
+// quoted literals and identifiers are left alone.
+func rebind(dialect Dialect, query string) string {
+	if dialect != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote rune
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// sqlConn is the context-aware subset of *sql.DB and *sql.Tx that
+// rebindConn runs queries on.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// rebindConn adapts queries to the dialect before handing them to conn, and
+// runs them under ctx, or without a deadline if it is nil.
+type rebindConn struct {
+	conn    sqlConn
+	dialect Dialect
+	ctx     context.Context
+}
+
+func (c rebindConn) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+func (c rebindConn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.conn.ExecContext(c.context(), rebind(c.dialect, query), args...)
+}
+
+func (c rebindConn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.conn.QueryContext(c.context(), rebind(c.dialect, query), args...)
+}
+
+func (c rebindConn) QueryRow(query string, args ...any) *sql.Row {
+	return c.conn.QueryRowContext(c.context(), rebind(c.dialect, query), args...)
+}
@@ -0,0 +1,141 @@
+package database_test
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"bitespeed-identity-reconciliation/internal/database/dbtest"
+	"bitespeed-identity-reconciliation/internal/models"
+	"testing"
+	"time"
+)
+
+// TestMigrateTo_RoundTripDialect runs against PostgreSQL when
+// TEST_POSTGRES_DSN is set, covering the postgres migrations.
+func TestMigrateTo_RoundTripDialect(t *testing.T) {
+	db := dbtest.Open(t)
+
+	if err := database.MigrateTo(db, 0); err != nil {
+		t.Fatalf("MigrateTo(0) error = %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if version != database.LatestSchemaVersion() {
+		t.Errorf("Expected version %d, got %d", database.LatestSchemaVersion(), version)
+	}
+}
+
+func TestContactRepository_ReturnsInsertedIDs(t *testing.T) {
+	db := dbtest.Open(t)
+	repo := database.NewContactRepository(db)
+
+	dbtest.Exec(t, db, `INSERT INTO contacts (id, email, link_precedence) VALUES (7, 'doc@hillvalley.edu', 'primary')`)
+
+	email := "marty@hillvalley.edu"
+	contact := &models.Contact{Email: &email, LinkPrecedence: "primary"}
+	if err := repo.Create(contact); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if contact.ID != 8 {
+		t.Errorf("Expected contact ID 8, got %d", contact.ID)
+	}
+
+	entry := &models.BlockedIdentifier{Type: models.IdentifierEmail, Value: email}
+	for i, wantCreated := range []bool{true, false} {
+		created, err := repo.CreateBlockedIdentifier(entry)
+		if err != nil {
+			t.Fatalf("CreateBlockedIdentifier() error = %v", err)
+		}
+		if created != wantCreated {
+			t.Errorf("Call %d: expected created %v, got %v", i, wantCreated, created)
+		}
+	}
+	if entry.ID != 1 {
+		t.Errorf("Expected blocklist entry ID 1, got %d", entry.ID)
+	}
+}
+
+func TestContactRepository_LockKeys(t *testing.T) {
+	db := dbtest.Open(t)
+	repo := database.NewContactRepository(db)
+
+	if database.DialectOf(db) != database.Postgres {
+		// SQLite transactions exclude each other, so no key is locked.
+		if took, err := repo.LockKeys([]string{"email:doc@hillvalley.edu"}); err != nil || took {
+			t.Errorf("Expected no locks on SQLite, got %v, %v", took, err)
+		}
+		return
+	}
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	holder := make(chan error, 1)
+	go func() {
+		holder <- repo.WithTx(func(tx *database.ContactRepository) error {
+			if _, err := tx.LockKeys([]string{"email:doc@hillvalley.edu"}); err != nil {
+				return err
+			}
+			close(held)
+			<-release
+			return nil
+		})
+	}()
+	select {
+	case <-held:
+	case err := <-holder:
+		t.Fatalf("Failed to take the lock: %v", err)
+	}
+
+	lockIn := func(lock func(tx *database.ContactRepository) error) <-chan error {
+		done := make(chan error, 1)
+		go func() { done <- repo.WithTx(lock) }()
+		return done
+	}
+	lockKeys := func(keys ...string) <-chan error {
+		return lockIn(func(tx *database.ContactRepository) error {
+			_, err := tx.LockKeys(keys)
+			return err
+		})
+	}
+
+	// Other keys are free, the held one and LockAll wait for its
+	// transaction.
+	select {
+	case err := <-lockKeys("email:marty@hillvalley.edu", "phone:+15550100000"):
+		if err != nil {
+			t.Fatalf("LockKeys() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a different key to be locked at once")
+	}
+	waiting := []<-chan error{
+		lockKeys("phone:+15550100000", "email:doc@hillvalley.edu"),
+		lockIn(func(tx *database.ContactRepository) error { return tx.LockAll() }),
+	}
+	for _, done := range waiting {
+		select {
+		case err := <-done:
+			t.Fatalf("Expected to wait for the held lock, got %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	close(release)
+	if err := <-holder; err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+	for _, done := range waiting {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Lock error = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the lock once the holder committed")
+		}
+	}
+}
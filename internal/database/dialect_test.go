@@ -0,0 +1,88 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{
+			name:    "SQLite is unchanged",
+			dialect: SQLite,
+			query:   `SELECT id FROM contacts WHERE email = ? OR phone_number = ?`,
+			want:    `SELECT id FROM contacts WHERE email = ? OR phone_number = ?`,
+		},
+		{
+			name:    "Numbered placeholders",
+			dialect: Postgres,
+			query:   `SELECT id FROM contacts WHERE email = ? OR phone_number = ?`,
+			want:    `SELECT id FROM contacts WHERE email = $1 OR phone_number = $2`,
+		},
+		{
+			name:    "Quoted question marks",
+			dialect: Postgres,
+			query:   `SELECT '?', "a?b" FROM contacts WHERE id IN (?,?)`,
+			want:    `SELECT '?', "a?b" FROM contacts WHERE id IN ($1,$2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rebind(tt.dialect, tt.query); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsPostgresDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want bool
+	}{
+		{"./contacts.db", false},
+		{":memory:", false},
+		{"postgres://localhost/contacts", true},
+		{"postgresql://user@localhost:5432/contacts?sslmode=disable", true},
+	}
+
+	for _, tt := range tests {
+		if got := IsPostgresDSN(tt.dsn); got != tt.want {
+			t.Errorf("IsPostgresDSN(%q): expected %v, got %v", tt.dsn, tt.want, got)
+		}
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"./contacts.db", "./contacts.db?_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate"},
+		{"file:contacts.db?cache=shared", "file:contacts.db?_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate&cache=shared"},
+		{"contacts.db?_journal_mode=DELETE&_txlock=deferred", "contacts.db?_busy_timeout=10000&_journal_mode=DELETE&_txlock=immediate"},
+	}
+
+	for _, tt := range tests {
+		got, err := sqliteDSN(tt.path)
+		if err != nil || got != tt.want {
+			t.Errorf("sqliteDSN(%q): expected %q, got %q, %v", tt.path, tt.want, got, err)
+		}
+	}
+
+	if _, err := sqliteDSN("contacts.db?cache=%zz"); err == nil {
+		t.Error("Expected an error for an invalid query string")
+	}
+
+	db, err := InitDB("file:" + filepath.Join(t.TempDir(), "contacts.db") + "?cache=shared")
+	if err != nil {
+		t.Fatalf("Failed to open a path with a query string: %v", err)
+	}
+	db.Close()
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"database/sql"
+	"time"
+)
+
+// linkState is a contact's link as stored before a change.
+type linkState struct {
+	linkedID       *int
+	linkPrecedence *string
+}
+
+// currentLink returns the link of a live contact, or nil if there is none.
+func (r *ContactRepository) currentLink(id int) (*linkState, error) {
+	var state linkState
+	err := r.conn.QueryRow(`
+		SELECT linked_id, link_precedence
+		FROM contacts
+		WHERE id = ? AND deleted_at IS NULL
+	`, id).Scan(&state.linkedID, &state.linkPrecedence)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// recordEvent appends an entry to the contact's history. The history is
+// append-only: events are never updated or deleted.
+func (r *ContactRepository) recordEvent(contactID int, eventType string, before *linkState, linkedID *int, linkPrecedence *string, at time.Time) error {
+	query := `
+		INSERT INTO contact_events (contact_id, event_type, previous_linked_id, previous_link_precedence, linked_id, link_precedence, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	if before == nil {
+		before = &linkState{}
+	}
+	_, err := r.conn.Exec(query, contactID, eventType, before.linkedID, before.linkPrecedence, linkedID, linkPrecedence, at)
+	return err
+}
+
+// linkEventType names a change of link from before to linkPrecedence.
+func linkEventType(before *linkState, linkPrecedence string) string {
+	previous := ""
+	if before.linkPrecedence != nil {
+		previous = *before.linkPrecedence
+	}
+
+	switch {
+	case previous == "primary" && linkPrecedence == "secondary":
+		return models.EventDemoted
+	case previous == "secondary" && linkPrecedence == "primary":
+		return models.EventPromoted
+	default:
+		return models.EventLinked
+	}
+}
+
+func sameLink(before *linkState, linkedID *int, linkPrecedence string) bool {
+	if before.linkPrecedence == nil || *before.linkPrecedence != linkPrecedence {
+		return false
+	}
+	if before.linkedID == nil || linkedID == nil {
+		return before.linkedID == nil && linkedID == nil
+	}
+	return *before.linkedID == *linkedID
+}
+
+// FindEventsByContactID returns the history of a contact, oldest first.
+func (r *ContactRepository) FindEventsByContactID(contactID int) ([]models.ContactEvent, error) {
+	query := `
+		SELECT id, contact_id, event_type, previous_linked_id, previous_link_precedence, linked_id, link_precedence, created_at
+		FROM contact_events
+		WHERE contact_id = ?
+		ORDER BY id
+	`
+
+	rows, err := r.conn.Query(query, contactID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.ContactEvent{}
+	for rows.Next() {
+		var event models.ContactEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.ContactID,
+			&event.Type,
+			&event.PreviousLinkedID,
+			&event.PreviousLinkPrecedence,
+			&event.LinkedID,
+			&event.LinkPrecedence,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// FindEverLinked returns every contact, soft-deleted ones included, that is
+// or ever was linked to id, and every contact id is or ever was linked to,
+// going by both the contacts table and the link history. Merges and their
+// reverts change links through the same history, so it covers them too.
+func (r *ContactRepository) FindEverLinked(id int) ([]models.Contact, error) {
+	query := `
+		SELECT id, phone_number, email, COALESCE(phone_normalized, phone_number), COALESCE(email_normalized, email), linked_id, link_precedence, created_at, updated_at, deleted_at
+		FROM contacts
+		WHERE id != ? AND id IN (
+			SELECT id FROM contacts WHERE linked_id = ?
+			UNION SELECT linked_id FROM contacts WHERE id = ?
+			UNION SELECT contact_id FROM contact_events WHERE linked_id = ? OR previous_linked_id = ?
+			UNION SELECT linked_id FROM contact_events WHERE contact_id = ?
+			UNION SELECT previous_linked_id FROM contact_events WHERE contact_id = ?
+		)
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := r.conn.Query(query, id, id, id, id, id, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanContacts(rows)
+}
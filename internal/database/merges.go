@@ -0,0 +1,152 @@
+package database
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CreateMerge records a merge together with the change it made to every
+// contact, and fills in its ID, creation time and the newest contact event,
+// which marks where events that depend on the merge start. It must run in
+// the merge's transaction, after its writes.
+func (r *ContactRepository) CreateMerge(merge *models.Merge) error {
+	query := `
+		INSERT INTO merges (primary_contact_id, triggered_by, last_event_id, created_at)
+		VALUES (?, ?, (SELECT COALESCE(MAX(id), 0) FROM contact_events), ?)
+		RETURNING id, last_event_id
+	`
+
+	now := time.Now()
+	err := r.conn.QueryRow(query, merge.PrimaryContactID, merge.TriggeredBy, now).Scan(&merge.ID, &merge.LastEventID)
+	if err != nil {
+		return err
+	}
+	merge.CreatedAt = now
+
+	contactQuery := `
+		INSERT INTO merge_contacts (merge_id, contact_id, previous_linked_id, previous_link_precedence, linked_id, link_precedence)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	for _, contact := range merge.Contacts {
+		_, err := r.conn.Exec(contactQuery,
+			merge.ID,
+			contact.ContactID,
+			contact.PreviousLinkedID,
+			contact.PreviousLinkPrecedence,
+			contact.LinkedID,
+			contact.LinkPrecedence,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindMergeByID returns a merge with its contact changes, or nil if there is
+// none.
+func (r *ContactRepository) FindMergeByID(id int) (*models.Merge, error) {
+	query := `
+		SELECT id, primary_contact_id, triggered_by, last_event_id, created_at, reverted_at
+		FROM merges
+		WHERE id = ?
+	`
+
+	var merge models.Merge
+	err := r.conn.QueryRow(query, id).Scan(
+		&merge.ID,
+		&merge.PrimaryContactID,
+		&merge.TriggeredBy,
+		&merge.LastEventID,
+		&merge.CreatedAt,
+		&merge.RevertedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contactQuery := `
+		SELECT contact_id, previous_linked_id, previous_link_precedence, linked_id, link_precedence
+		FROM merge_contacts
+		WHERE merge_id = ?
+		ORDER BY id
+	`
+	rows, err := r.conn.Query(contactQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merge.Contacts = []models.MergeContact{}
+	for rows.Next() {
+		var contact models.MergeContact
+		err := rows.Scan(
+			&contact.ContactID,
+			&contact.PreviousLinkedID,
+			&contact.PreviousLinkPrecedence,
+			&contact.LinkedID,
+			&contact.LinkPrecedence,
+		)
+		if err != nil {
+			return nil, err
+		}
+		merge.Contacts = append(merge.Contacts, contact)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &merge, nil
+}
+
+// MarkMergeReverted records when a merge was reverted.
+func (r *ContactRepository) MarkMergeReverted(id int, revertedAt time.Time) error {
+	_, err := r.conn.Exec(`UPDATE merges SET reverted_at = ? WHERE id = ?`, revertedAt, id)
+	return err
+}
+
+// HasEventsAfter reports whether any contact event newer than eventID
+// concerns one of the contacts, either directly or by linking to it.
+func (r *ContactRepository) HasEventsAfter(eventID int, contactIDs []int) (bool, error) {
+	if len(contactIDs) == 0 {
+		return false, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(contactIDs)), ",")
+	args := []any{eventID}
+	for i := 0; i < 3; i++ {
+		for _, id := range contactIDs {
+			args = append(args, id)
+		}
+	}
+
+	query := fmt.Sprintf(`
+		SELECT 1 FROM contact_events
+		WHERE id > ?
+		AND (contact_id IN (%[1]s) OR linked_id IN (%[1]s) OR previous_linked_id IN (%[1]s))
+		LIMIT 1
+	`, placeholders)
+
+	var found int
+	err := r.conn.QueryRow(query, args...).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RestoreLink puts a contact back on the link it had before a merge and
+// records the change as a revert.
+func (r *ContactRepository) RestoreLink(id int, linkedID *int, linkPrecedence string) error {
+	return r.updateLink(id, linkedID, linkPrecedence, models.EventReverted)
+}
@@ -0,0 +1,297 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// migration is one schema change, read from a pair of files named
+// NNNN_name.up.sql and NNNN_name.down.sql in the migrations directory of
+// each dialect.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+var migrations = mustLoadMigrations()
+
+// mustLoadMigrations loads the migrations of every dialect. The dialects
+// must stay in step, version for version, so a schema version means the
+// same thing whichever database holds it.
+func mustLoadMigrations() map[Dialect][]migration {
+	loaded := make(map[Dialect][]migration)
+	for _, dialect := range []Dialect{SQLite, Postgres} {
+		set, err := loadMigrations(migrationFiles, "migrations/"+string(dialect))
+		if err != nil {
+			panic(fmt.Sprintf("invalid embedded %s migrations: %v", dialect, err))
+		}
+		loaded[dialect] = set
+	}
+
+	if err := sameMigrations(loaded[SQLite], loaded[Postgres]); err != nil {
+		panic(fmt.Sprintf("embedded postgres migrations differ from sqlite: %v", err))
+	}
+	return loaded
+}
+
+func loadMigrations(files fs.FS, dir string) ([]migration, error) {
+	paths, err := fs.Glob(files, dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, path := range paths {
+		base := strings.TrimPrefix(path, dir+"/")
+		stem, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("%s: expected NNNN_name.up.sql or NNNN_name.down.sql", base)
+		}
+		prefix, name, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("%s: expected a positive version prefix", base)
+		}
+
+		content, err := fs.ReadFile(files, path)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if m.name != name {
+			return nil, fmt.Errorf("%s: version %d is already used by %q", base, version, m.name)
+		}
+		if direction == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	var loaded []migration
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.version, m.name)
+		}
+		loaded = append(loaded, *m)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].version < loaded[j].version })
+
+	for i, m := range loaded {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration versions must be consecutive from 1, found %04d", m.version)
+		}
+	}
+	return loaded, nil
+}
+
+func sameMigrations(a, b []migration) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("%d migrations against %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].name != b[i].name {
+			return fmt.Errorf("version %04d is %q against %q", a[i].version, a[i].name, b[i].name)
+		}
+	}
+	return nil
+}
+
+// LatestSchemaVersion is the version Migrate brings a database to.
+func LatestSchemaVersion() int {
+	return len(migrations[SQLite])
+}
+
+// Migrate applies every pending migration.
+func Migrate(db *sql.DB) error {
+	return MigrateTo(db, LatestSchemaVersion())
+}
+
+// MigrateTo applies or rolls back migrations until the database is at the
+// given version. Each migration runs in its own transaction together with
+// its schema_migrations row, so a failure leaves the database at the last
+// version that completed.
+func MigrateTo(db *sql.DB, target int) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d, latest is %d", target, LatestSchemaVersion())
+	}
+
+	current, err := prepareMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	dialect := DialectOf(db)
+	set := migrations[dialect]
+	for current < target {
+		m := set[current]
+		if err := runMigration(db, m, m.up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(rebind(dialect, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+				m.version, m.name, time.Now())
+			return err
+		}); err != nil {
+			return fmt.Errorf("migration %04d_%s up: %w", m.version, m.name, err)
+		}
+		log.Printf("Applied migration %04d_%s", m.version, m.name)
+		current++
+	}
+
+	for current > target {
+		m := set[current-1]
+		if err := runMigration(db, m, m.down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(rebind(dialect, `DELETE FROM schema_migrations WHERE version = ?`), m.version)
+			return err
+		}); err != nil {
+			return fmt.Errorf("migration %04d_%s down: %w", m.version, m.name, err)
+		}
+		log.Printf("Rolled back migration %04d_%s", m.version, m.name)
+		current--
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the version of the newest applied migration, or 0
+// for an empty database.
+func SchemaVersion(db *sql.DB) (int, error) {
+	return prepareMigrations(db)
+}
+
+func runMigration(db *sql.DB, m migration, script string, record func(tx *sql.Tx) error) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(script); err != nil {
+		return err
+	}
+	if err = record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// prepareMigrations creates schema_migrations if needed and returns the
+// current version. Databases created before migrations existed already
+// hold part of the schema: they are recorded at the version their contacts
+// table matches, and the later migrations, which only create missing
+// tables, bring them up to date.
+func prepareMigrations(db *sql.DB) (int, error) {
+	dialect := DialectOf(db)
+	exists, err := hasTable(rebindConn{conn: db, dialect: dialect}, dialect, "schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		if err := adoptExistingSchema(db); err != nil {
+			return 0, err
+		}
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func adoptExistingSchema(db *sql.DB) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	dialect := DialectOf(db)
+	conn := rebindConn{conn: tx, dialect: dialect}
+	_, err = conn.Exec(`
+		CREATE TABLE schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	adopted := 0
+	if exists, err := hasTable(conn, dialect, "contacts"); err != nil {
+		return err
+	} else if exists {
+		adopted = 1
+		normalized, err := hasColumn(conn, dialect, "contacts", "email_normalized")
+		if err != nil {
+			return err
+		}
+		if normalized {
+			adopted = 2
+		}
+	}
+
+	for _, m := range migrations[dialect][:adopted] {
+		_, err = conn.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.name, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if adopted > 0 {
+		log.Printf("Adopted existing database at schema version %d", adopted)
+	}
+	return nil
+}
+
+func hasTable(conn dbtx, dialect Dialect, table string) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if dialect == Postgres {
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+	}
+
+	var count int
+	err := conn.QueryRow(query, table).Scan(&count)
+	return count > 0, err
+}
+
+func hasColumn(conn dbtx, dialect Dialect, table, column string) (bool, error) {
+	query := `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+	if dialect == Postgres {
+		query = `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`
+	}
+
+	var count int
+	err := conn.QueryRow(query, table, column).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"bitespeed-identity-reconciliation/internal/normalize"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrate_UpgradesFixtures(t *testing.T) {
+	tests := []struct {
+		name            string
+		fixture         string
+		wantEvents      int
+		wantBlocklisted int
+	}{
+		{
+			name:    "First release",
+			fixture: "testdata/baseline.sql",
+		},
+		{
+			name:            "Before migrations",
+			fixture:         "testdata/pre_migrations.sql",
+			wantEvents:      2,
+			wantBlocklisted: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFixtureDB(t, tt.fixture)
+
+			if err := Migrate(db); err != nil {
+				t.Fatalf("Migrate() error = %v", err)
+			}
+			// A second run has nothing left to do.
+			if err := Migrate(db); err != nil {
+				t.Fatalf("Migrate() second run error = %v", err)
+			}
+
+			version, err := SchemaVersion(db)
+			if err != nil {
+				t.Fatalf("SchemaVersion() error = %v", err)
+			}
+			if version != LatestSchemaVersion() {
+				t.Errorf("Expected schema version %d, got %d", LatestSchemaVersion(), version)
+			}
+
+			repo := NewContactRepository(db)
+			if _, err := repo.Renormalize(testNormalizer(t)); err != nil {
+				t.Fatalf("Renormalize() error = %v", err)
+			}
+
+			contacts, err := repo.FindByEmailOrPhone(stringPtr("lorraine@hillvalley.edu"), nil)
+			if err != nil {
+				t.Fatalf("FindByEmailOrPhone() error = %v", err)
+			}
+			if len(contacts) != 1 || contacts[0].ID != 1 {
+				t.Fatalf("Expected contact 1 to survive the upgrade, got %v", contacts)
+			}
+			secondaries, err := repo.FindByLinkedID(1)
+			if err != nil {
+				t.Fatalf("FindByLinkedID() error = %v", err)
+			}
+			if len(secondaries) != 1 || secondaries[0].ID != 23 {
+				t.Errorf("Expected secondary 23 to keep its link, got %v", secondaries)
+			}
+
+			assertCount(t, db, `SELECT COUNT(*) FROM contact_events`, tt.wantEvents)
+			assertCount(t, db, `SELECT COUNT(*) FROM identifier_blocklist`, tt.wantBlocklisted)
+		})
+	}
+}
+
+func TestMigrateTo_RoundTrip(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := MigrateTo(db, 0); err != nil {
+		t.Fatalf("MigrateTo(0) error = %v", err)
+	}
+	assertCount(t, db, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`, 0)
+	assertCount(t, db, `SELECT COUNT(*) FROM schema_migrations`, 0)
+
+	if err := MigrateTo(db, 2); err != nil {
+		t.Fatalf("MigrateTo(2) error = %v", err)
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if version != 2 {
+		t.Errorf("Expected schema version 2, got %d", version)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	assertCount(t, db, `SELECT COUNT(*) FROM schema_migrations`, LatestSchemaVersion())
+
+	if err := MigrateTo(db, LatestSchemaVersion()+1); err == nil {
+		t.Error("Expected an error for an unknown version")
+	}
+}
+
+func TestMigrate_FailedMigrationRollsBack(t *testing.T) {
+	db := newTestDB(t)
+	if err := MigrateTo(db, 1); err != nil {
+		t.Fatalf("MigrateTo(1) error = %v", err)
+	}
+
+	// A column left behind by hand makes migration 2 fail half-way.
+	execSQL(t, db, `ALTER TABLE contacts ADD COLUMN email_normalized TEXT`)
+	execSQL(t, db, `DELETE FROM schema_migrations WHERE version > 1`)
+
+	if err := Migrate(db); err == nil {
+		t.Fatal("Expected migration 2 to fail")
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if version != 1 {
+		t.Errorf("Expected the database to stay at version 1, got %d", version)
+	}
+	exists, err := hasColumn(db, SQLite, "contacts", "phone_normalized")
+	if err != nil {
+		t.Fatalf("hasColumn() error = %v", err)
+	}
+	if exists {
+		t.Error("Expected the partial migration to be rolled back")
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			files: fstest.MapFS{
+				"migrations/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+				"migrations/0001_a.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			name: "Missing down file",
+			files: fstest.MapFS{
+				"migrations/0001_a.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Gap in versions",
+			files: fstest.MapFS{
+				"migrations/0002_a.up.sql":   {Data: []byte("SELECT 1;")},
+				"migrations/0002_a.down.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad name",
+			files: fstest.MapFS{
+				"migrations/first.up.sql":   {Data: []byte("SELECT 1;")},
+				"migrations/first.down.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "migrations")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadMigrations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newFixtureDB builds a database file from a SQL fixture in testdata.
+func newFixtureDB(t *testing.T, fixture string) *sql.DB {
+	t.Helper()
+
+	script, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	db, err := Open(filepath.Join(t.TempDir(), "contacts.db"))
+	if err != nil {
+		t.Fatalf("Failed to create fixture database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	execSQL(t, db, string(script))
+	return db
+}
+
+func testNormalizer(t *testing.T) *normalize.Normalizer {
+	t.Helper()
+	n, err := normalize.New(normalize.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	return n
+}
+
+func assertCount(t *testing.T, db *sql.DB, query string, want int) {
+	t.Helper()
+	var got int
+	if err := db.QueryRow(query).Scan(&got); err != nil {
+		t.Fatalf("Failed to run %q: %v", query, err)
+	}
+	if got != want {
+		t.Errorf("%s: expected %d, got %d", query, want, got)
+	}
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	// Every connection to ":memory:" is a separate database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func execSQL(t *testing.T, db *sql.DB, query string) {
+	t.Helper()
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("Failed to execute SQL: %v", err)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,17 @@
+-- The original schema. linked_id is not a foreign key: SQLite never
+-- enforced the one it declares, and the service repairs secondaries whose
+-- primary has gone missing rather than relying on the constraint.
+CREATE TABLE IF NOT EXISTS contacts (
+    id SERIAL PRIMARY KEY,
+    phone_number TEXT,
+    email TEXT,
+    linked_id INTEGER,
+    link_precedence TEXT NOT NULL CHECK(link_precedence IN ('primary', 'secondary')),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_phone ON contacts(phone_number) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_email ON contacts(email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_linked_id ON contacts(linked_id) WHERE deleted_at IS NULL;
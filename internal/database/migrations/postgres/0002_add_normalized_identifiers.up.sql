@@ -0,0 +1,6 @@
+ALTER TABLE contacts ADD COLUMN phone_normalized TEXT;
+ALTER TABLE contacts ADD COLUMN email_normalized TEXT;
+
+-- Lookups fall back to the raw value for rows not yet backfilled.
+CREATE INDEX IF NOT EXISTS idx_phone_normalized ON contacts((COALESCE(phone_normalized, phone_number))) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_email_normalized ON contacts((COALESCE(email_normalized, email))) WHERE deleted_at IS NULL;
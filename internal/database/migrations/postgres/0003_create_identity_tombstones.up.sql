@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS identity_tombstones (
+    id SERIAL PRIMARY KEY,
+    identifier_hash TEXT NOT NULL UNIQUE,
+    receipt_id TEXT NOT NULL,
+    erased_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS identifier_blocklist (
+    id SERIAL PRIMARY KEY,
+    type TEXT NOT NULL CHECK(type IN ('email', 'phone')),
+    value TEXT NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (type, value)
+);
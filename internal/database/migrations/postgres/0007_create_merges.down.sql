@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS merge_contacts;
+DROP TABLE IF EXISTS merges;
@@ -0,0 +1,22 @@
+-- Follows contact_events (0006): last_event_id is the newest event a merge
+-- wrote, which revert checks later events against.
+CREATE TABLE IF NOT EXISTS merges (
+    id SERIAL PRIMARY KEY,
+    primary_contact_id INTEGER NOT NULL,
+    triggered_by TEXT NOT NULL,
+    last_event_id INTEGER NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    reverted_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS merge_contacts (
+    id SERIAL PRIMARY KEY,
+    merge_id INTEGER NOT NULL REFERENCES merges(id),
+    contact_id INTEGER NOT NULL,
+    previous_linked_id INTEGER,
+    previous_link_precedence TEXT,
+    linked_id INTEGER,
+    link_precedence TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_merge_contacts_merge_id ON merge_contacts(merge_id);
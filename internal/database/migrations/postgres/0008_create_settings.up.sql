@@ -0,0 +1,6 @@
+-- Holds values the application keeps between restarts, such as the
+-- version of the normalizer that filled in the normalized identifiers.
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
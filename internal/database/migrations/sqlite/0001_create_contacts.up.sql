@@ -0,0 +1,17 @@
+-- The original schema. IF NOT EXISTS lets databases created before
+-- migrations existed adopt it.
+CREATE TABLE IF NOT EXISTS contacts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    phone_number TEXT,
+    email TEXT,
+    linked_id INTEGER,
+    link_precedence TEXT NOT NULL CHECK(link_precedence IN ('primary', 'secondary')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    FOREIGN KEY (linked_id) REFERENCES contacts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_phone ON contacts(phone_number) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_email ON contacts(email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_linked_id ON contacts(linked_id) WHERE deleted_at IS NULL;
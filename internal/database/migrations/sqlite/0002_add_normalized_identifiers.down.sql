@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_phone_normalized;
+DROP INDEX IF EXISTS idx_email_normalized;
+
+ALTER TABLE contacts DROP COLUMN phone_normalized;
+ALTER TABLE contacts DROP COLUMN email_normalized;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS identity_tombstones (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    identifier_hash TEXT NOT NULL UNIQUE,
+    receipt_id TEXT NOT NULL,
+    erased_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS link_exclusions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    contact_id INTEGER NOT NULL,
+    excluded_contact_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (contact_id, excluded_contact_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_exclusions_excluded ON link_exclusions(excluded_contact_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS contact_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    contact_id INTEGER NOT NULL,
+    event_type TEXT NOT NULL,
+    previous_linked_id INTEGER,
+    previous_link_precedence TEXT,
+    linked_id INTEGER,
+    link_precedence TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_events_contact_id ON contact_events(contact_id);
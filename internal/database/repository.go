@@ -2,158 +2,765 @@ package database
 
 import (
 	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/normalize"
+	"context"
 	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
 	"time"
 )
 
+// dbtx is the subset of *sql.DB and *sql.Tx used by the repository, so the
+// same queries can run either directly on the pool or inside a transaction.
+type dbtx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 type ContactRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	conn    dbtx
+	dialect Dialect
+	// ctx bounds every query and transaction of the repository. It is nil
+	// for a repository that runs without a deadline.
+	ctx context.Context
+	// savepoints counts the savepoints open in the current transaction.
+	savepoints int
 }
 
 func NewContactRepository(db *sql.DB) *ContactRepository {
-	return &ContactRepository{db: db}
+	dialect := DialectOf(db)
+	return &ContactRepository{db: db, conn: rebindConn{conn: db, dialect: dialect}, dialect: dialect}
+}
+
+// WithContext returns a copy of the repository whose queries and
+// transactions run under ctx. Once ctx is done its queries fail, and a
+// transaction it started is rolled back instead of committed. A
+// transaction-scoped repository keeps the context of its transaction.
+func (r *ContactRepository) WithContext(ctx context.Context) *ContactRepository {
+	if r.db == nil {
+		return r
+	}
+	scoped := *r
+	scoped.ctx = ctx
+	scoped.conn = rebindConn{conn: r.db, dialect: r.dialect, ctx: ctx}
+	return &scoped
 }
 
+// writeLockKey is the PostgreSQL advisory lock LockAll takes exclusively
+// and LockKeys takes shared. It doubles as the namespace of the key locks,
+// which are two-part advisory locks and so never collide with it.
+const writeLockKey = 0x62697465
+
+// LockKeys takes a transaction-scoped lock on each key, such as a normalized
+// identifier, and reports whether it took any. Only PostgreSQL needs them:
+// SQLite's BEGIN IMMEDIATE transactions already exclude each other, so there
+// LockKeys does nothing. Keys are locked by hash in ascending order, so
+// overlapping sets taken in one call cannot deadlock; keys whose hashes
+// collide share a lock, which costs concurrency but not correctness.
+func (r *ContactRepository) LockKeys(keys []string) (bool, error) {
+	if r.dialect != Postgres || len(keys) == 0 {
+		return false, nil
+	}
+
+	if _, err := r.conn.Exec(`SELECT pg_advisory_xact_lock_shared(?)`, writeLockKey); err != nil {
+		return false, err
+	}
+
+	hashes := make([]int32, 0, len(keys))
+	for _, key := range keys {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		hashes = append(hashes, int32(h.Sum32()))
+	}
+	slices.Sort(hashes)
+	for _, hash := range slices.Compact(hashes) {
+		if _, err := r.conn.Exec(`SELECT pg_advisory_xact_lock(?, ?)`, writeLockKey, hash); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// LockAll takes a transaction-scoped lock that waits for every transaction
+// holding key locks and keeps new ones out, for writes that cannot name the
+// keys they touch up front. It does nothing on SQLite.
+func (r *ContactRepository) LockAll() error {
+	if r.dialect != Postgres {
+		return nil
+	}
+	_, err := r.conn.Exec(`SELECT pg_advisory_xact_lock(?)`, writeLockKey)
+	return err
+}
+
+// WithTx runs fn against a repository bound to a single transaction. The
+// transaction is committed if fn returns nil and rolled back otherwise,
+// including when fn panics. Calling WithTx on a repository that is already
+// transaction-scoped runs fn in a savepoint of the current transaction, so
+// a failure undoes only fn's writes and the caller decides whether the
+// transaction goes on.
+func (r *ContactRepository) WithTx(fn func(repo *ContactRepository) error) error {
+	if r.db == nil {
+		return r.withSavepoint(fn)
+	}
+
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	if err := fn(&ContactRepository{conn: rebindConn{conn: tx, dialect: r.dialect, ctx: ctx}, dialect: r.dialect, ctx: ctx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+func (r *ContactRepository) withSavepoint(fn func(repo *ContactRepository) error) error {
+	name := fmt.Sprintf("sp_%d", r.savepoints+1)
+	if _, err := r.conn.Exec(`SAVEPOINT ` + name); err != nil {
+		return err
+	}
+
+	released := false
+	defer func() {
+		if !released {
+			r.conn.Exec(`ROLLBACK TO SAVEPOINT ` + name)
+			r.conn.Exec(`RELEASE SAVEPOINT ` + name)
+		}
+	}()
+
+	if err := fn(&ContactRepository{conn: r.conn, dialect: r.dialect, ctx: r.ctx, savepoints: r.savepoints + 1}); err != nil {
+		return err
+	}
+
+	if _, err := r.conn.Exec(`RELEASE SAVEPOINT ` + name); err != nil {
+		return err
+	}
+	released = true
+	return nil
+}
+
+// FindByEmailOrPhone matches on normalized identifiers. Rows stored before
+// normalization existed are compared on their raw value until normalized.
 func (r *ContactRepository) FindByEmailOrPhone(email, phoneNumber *string) ([]models.Contact, error) {
 	query := `
-		SELECT id, phone_number, email, linked_id, link_precedence, created_at, updated_at, deleted_at
-        FROM contacts 
-        WHERE deleted_at IS NULL 
-        AND (email = ? OR phone_number = ?)
-        ORDER BY created_at ASC
+		SELECT id, phone_number, email, COALESCE(phone_normalized, phone_number), COALESCE(email_normalized, email), linked_id, link_precedence, created_at, updated_at, deleted_at
+		FROM contacts
+		WHERE deleted_at IS NULL
+		AND (COALESCE(email_normalized, email) = ? OR COALESCE(phone_normalized, phone_number) = ?)
+		ORDER BY created_at ASC
 	`
-	
-	rows, err := r.db.Query(query, email, phoneNumber)
+
+	rows, err := r.conn.Query(query, email, phoneNumber)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var contacts []models.Contact
+	return scanContacts(rows)
+}
+
+func (r *ContactRepository) FindByLinkedID(linkedID int) ([]models.Contact, error) {
+	query := `
+		SELECT id, phone_number, email, COALESCE(phone_normalized, phone_number), COALESCE(email_normalized, email), linked_id, link_precedence, created_at, updated_at, deleted_at
+		FROM contacts
+		WHERE deleted_at IS NULL AND linked_id = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.conn.Query(query, linkedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanContacts(rows)
+}
+
+func (r *ContactRepository) Create(contact *models.Contact) error {
+	query := `
+		INSERT INTO contacts (phone_number, email, phone_normalized, email_normalized, linked_id, link_precedence, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	now := time.Now()
+	contact.CreatedAt = now
+	contact.UpdatedAt = now
+
+	err := r.conn.QueryRow(query,
+		contact.PhoneNumber,
+		contact.Email,
+		contact.NormalizedPhoneNumber,
+		contact.NormalizedEmail,
+		contact.LinkedID,
+		contact.LinkPrecedence,
+		contact.CreatedAt,
+		contact.UpdatedAt,
+	).Scan(&contact.ID)
+	if err != nil {
+		return err
+	}
+
+	return r.recordEvent(contact.ID, models.EventCreated, nil, contact.LinkedID, &contact.LinkPrecedence, now)
+}
+
+// UpdateLinkPrecedence re-links a contact. A nil linkedID makes it a root,
+// which is how a secondary is promoted to primary. The change is recorded
+// in the contact's history as a link, demotion or promotion.
+func (r *ContactRepository) UpdateLinkPrecedence(id int, linkedID *int, linkPrecedence string) error {
+	return r.updateLink(id, linkedID, linkPrecedence, "")
+}
+
+// DetachContact re-links a contact that is being split off its identity.
+// It differs from UpdateLinkPrecedence only in the event it records.
+func (r *ContactRepository) DetachContact(id int, linkedID *int, linkPrecedence string) error {
+	return r.updateLink(id, linkedID, linkPrecedence, models.EventSplit)
+}
+
+// updateLink changes the link of a live contact and records eventType, or
+// the event implied by the change when eventType is empty. Nothing is
+// recorded for a contact that is missing or whose link is unchanged, unless
+// eventType is given.
+func (r *ContactRepository) updateLink(id int, linkedID *int, linkPrecedence string, eventType string) error {
+	before, err := r.currentLink(id)
+	if err != nil || before == nil {
+		return err
+	}
+
+	query := `
+		UPDATE contacts
+		SET linked_id = ?, link_precedence = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	now := time.Now()
+	if _, err := r.conn.Exec(query, linkedID, linkPrecedence, now, id); err != nil {
+		return err
+	}
+
+	if eventType == "" {
+		if sameLink(before, linkedID, linkPrecedence) {
+			return nil
+		}
+		eventType = linkEventType(before, linkPrecedence)
+	}
+	return r.recordEvent(id, eventType, before, linkedID, &linkPrecedence, now)
+}
+
+// SoftDelete marks a contact as deleted. Deleted contacts are ignored by
+// every lookup.
+func (r *ContactRepository) SoftDelete(id int) error {
+	before, err := r.currentLink(id)
+	if err != nil || before == nil {
+		return err
+	}
+
+	query := `
+		UPDATE contacts
+		SET deleted_at = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	now := time.Now()
+	if _, err := r.conn.Exec(query, now, now, id); err != nil {
+		return err
+	}
+	return r.recordEvent(id, models.EventDeleted, before, nil, nil, now)
+}
+
+// DeleteContacts permanently removes the contacts with the given IDs,
+// soft-deleted ones included. An erased event is kept in the history of
+// each removed contact. It returns the number of rows removed.
+func (r *ContactRepository) DeleteContacts(ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := r.conn.Query(fmt.Sprintf(`
+		SELECT id, linked_id, link_precedence
+		FROM contacts
+		WHERE id IN (%s)
+	`, placeholders), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	type erased struct {
+		id     int
+		before linkState
+	}
+	var contacts []erased
 	for rows.Next() {
-		var contact models.Contact
-		err := rows.Scan(
-			&contact.ID,
-			&contact.PhoneNumber,
-			&contact.Email,
-            &contact.LinkedID,
-            &contact.LinkPrecedence,
-            &contact.CreatedAt,
-            &contact.UpdatedAt,
-            &contact.DeletedAt,
-		)
-		if err != nil {
+		var e erased
+		if err := rows.Scan(&e.id, &e.before.linkedID, &e.before.linkPrecedence); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		contacts = append(contacts, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, e := range contacts {
+		if err := r.recordEvent(e.id, models.EventErased, &e.before, nil, nil, now); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := r.conn.Exec(fmt.Sprintf(`
+		DELETE FROM contacts
+		WHERE id IN (%s)
+	`, placeholders), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// CreateTombstones records the hashes of erased identifiers. Hashes that are
+// already tombstoned are left as they are.
+func (r *ContactRepository) CreateTombstones(hashes []string, receiptID string, erasedAt time.Time) error {
+	query := `
+		INSERT INTO identity_tombstones (identifier_hash, receipt_id, erased_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (identifier_hash) DO NOTHING
+	`
+
+	for _, hash := range hashes {
+		if _, err := r.conn.Exec(query, hash, receiptID, erasedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasTombstone reports whether any of the identifier hashes was erased.
+func (r *ContactRepository) HasTombstone(hashes []string) (bool, error) {
+	query := `
+		SELECT 1 FROM identity_tombstones
+		WHERE identifier_hash = ?
+	`
+
+	for _, hash := range hashes {
+		var found int
+		err := r.conn.QueryRow(query, hash).Scan(&found)
+		if err == nil {
+			return true, nil
+		}
+		if err != sql.ErrNoRows {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// CreateLinkExclusion records a do-not-link rule between two contacts.
+// Recording the same rule twice is a no-op.
+func (r *ContactRepository) CreateLinkExclusion(contactID, excludedContactID int) error {
+	query := `
+		INSERT INTO link_exclusions (contact_id, excluded_contact_id)
+		VALUES (?, ?)
+		ON CONFLICT (contact_id, excluded_contact_id) DO NOTHING
+	`
+
+	_, err := r.conn.Exec(query, contactID, excludedContactID)
+	return err
+}
+
+// FindLinkExclusions returns the do-not-link rules between the given
+// contacts. Rules involving a contact outside the list are left out.
+func (r *ContactRepository) FindLinkExclusions(contactIDs []int) ([][2]int, error) {
+	if len(contactIDs) < 2 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(contactIDs)), ",")
+	args := make([]any, 0, 2*len(contactIDs))
+	for _, id := range contactIDs {
+		args = append(args, id)
+	}
+	for _, id := range contactIDs {
+		args = append(args, id)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT contact_id, excluded_contact_id
+		FROM link_exclusions
+		WHERE contact_id IN (%s) AND excluded_contact_id IN (%s)
+	`, placeholders, placeholders)
+
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exclusions [][2]int
+	for rows.Next() {
+		var rule [2]int
+		if err := rows.Scan(&rule[0], &rule[1]); err != nil {
 			return nil, err
 		}
-		contacts = append(contacts, contact)
+		exclusions = append(exclusions, rule)
 	}
+	return exclusions, rows.Err()
+}
+
+// CreateBlockedIdentifier adds an identifier to the blocklist and fills in
+// its ID and creation time. It returns false if the identifier is already
+// listed.
+func (r *ContactRepository) CreateBlockedIdentifier(entry *models.BlockedIdentifier) (bool, error) {
+	query := `
+		INSERT INTO identifier_blocklist (type, value, reason, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (type, value) DO NOTHING
+		RETURNING id
+	`
 
-	return contacts, nil
+	now := time.Now()
+	err := r.conn.QueryRow(query, entry.Type, entry.Value, entry.Reason, now).Scan(&entry.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	entry.CreatedAt = now
+	return true, nil
 }
 
-func (r *ContactRepository) FindByLinkedID(linkedID int) ([]models.Contact, error) {
+// ListBlockedIdentifiers returns every blocklisted identifier, oldest first.
+func (r *ContactRepository) ListBlockedIdentifiers() ([]models.BlockedIdentifier, error) {
 	query := `
-        SELECT id, phone_number, email, linked_id, link_precedence, created_at, updated_at, deleted_at
-        FROM contacts 
-        WHERE deleted_at IS NULL AND linked_id = ?
-        ORDER BY created_at ASC
-    `
+		SELECT id, type, value, reason, created_at
+		FROM identifier_blocklist
+		ORDER BY id
+	`
 
-	rows, err := r.db.Query(query, linkedID)
+	rows, err := r.conn.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var contacts []models.Contact
+	entries := []models.BlockedIdentifier{}
 	for rows.Next() {
-		var contact models.Contact
-		err := rows.Scan(
-			&contact.ID,
-            &contact.PhoneNumber,
-            &contact.Email,
-            &contact.LinkedID,
-            &contact.LinkPrecedence,
-            &contact.CreatedAt,
-            &contact.UpdatedAt,
-            &contact.DeletedAt,
-		)
-		if err != nil {
+		var entry models.BlockedIdentifier
+		if err := rows.Scan(&entry.ID, &entry.Type, &entry.Value, &entry.Reason, &entry.CreatedAt); err != nil {
 			return nil, err
 		}
-		contacts = append(contacts, contact)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteBlockedIdentifier removes an identifier from the blocklist. It
+// returns false if no entry has that ID.
+func (r *ContactRepository) DeleteBlockedIdentifier(id int) (bool, error) {
+	result, err := r.conn.Exec(`DELETE FROM identifier_blocklist WHERE id = ?`, id)
+	if err != nil {
+		return false, err
 	}
 
-	return contacts, nil
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
 }
 
-func (r *ContactRepository) Create(contact *models.Contact) error {
+// normalizerVersionKey is the setting holding the version of the
+// normalizer that filled in the normalized identifiers.
+const normalizerVersionKey = "normalizer_version"
+
+// Renormalize fills in the normalized email and phone number of every
+// contact with n, in one transaction. It does nothing if n has the version
+// that last ran, so only the first start and a change of configuration
+// touch the rows. Values the normalizer rejects are cleared and keep
+// matching on their raw form. It returns the number of contacts updated.
+func (r *ContactRepository) Renormalize(n *normalize.Normalizer) (int, error) {
+	updated := 0
+	err := r.WithTx(func(repo *ContactRepository) error {
+		if err := repo.LockAll(); err != nil {
+			return err
+		}
+		var err error
+		updated, err = repo.renormalize(n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+func (r *ContactRepository) renormalize(n *normalize.Normalizer) (int, error) {
+	var version string
+	err := r.conn.QueryRow(`SELECT value FROM settings WHERE key = ?`, normalizerVersionKey).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if n.Version != "" && version == n.Version {
+		return 0, nil
+	}
+
 	query := `
-        INSERT INTO contacts (phone_number, email, linked_id, link_precedence, created_at, updated_at)
-        VALUES (?, ?, ?, ?, ?, ?)
-    `
-    
-    now := time.Now()
-    contact.CreatedAt = now
-    contact.UpdatedAt = now
-
-    result, err := r.db.Exec(query, 
-        contact.PhoneNumber, 
-        contact.Email, 
-        contact.LinkedID, 
-        contact.LinkPrecedence,
-        contact.CreatedAt,
-        contact.UpdatedAt,
-    )
-    if err != nil {
-        return err
-    }
-
-	id, err := result.LastInsertId()
-    if err != nil {
-        return err
-    }
-
-    contact.ID = int(id)
-    return nil
-}
-
-func (r *ContactRepository) UpdateLinkPrecedence(id int, linkedID int, linkPrecedence string) error {
-    query := `
-        UPDATE contacts 
-        SET linked_id = ?, link_precedence = ?, updated_at = ?
-        WHERE id = ? AND deleted_at IS NULL
-    `
-    
-    _, err := r.db.Exec(query, linkedID, linkPrecedence, time.Now(), id)
-    return err
+		SELECT id, phone_number, email, phone_normalized, email_normalized
+		FROM contacts
+		WHERE phone_number IS NOT NULL OR email IS NOT NULL
+	`
+
+	rows, err := r.conn.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	type stored struct {
+		id                    int
+		phoneNumber           *string
+		email                 *string
+		normalizedPhoneNumber *string
+		normalizedEmail       *string
+	}
+	var contacts []stored
+	for rows.Next() {
+		var c stored
+		if err := rows.Scan(&c.id, &c.phoneNumber, &c.email, &c.normalizedPhoneNumber, &c.normalizedEmail); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		contacts = append(contacts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	update := `UPDATE contacts SET phone_normalized = ?, email_normalized = ? WHERE id = ?`
+
+	updated := 0
+	for _, c := range contacts {
+		phoneNumber := normalizeStored(c.phoneNumber, n.NormalizePhone)
+		email := normalizeStored(c.email, n.NormalizeEmail)
+		if sameString(phoneNumber, c.normalizedPhoneNumber) && sameString(email, c.normalizedEmail) {
+			continue
+		}
+
+		if _, err := r.conn.Exec(update, phoneNumber, email, c.id); err != nil {
+			return 0, err
+		}
+		updated++
+	}
+
+	_, err = r.conn.Exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value
+	`, normalizerVersionKey, n.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// normalizeStored returns the normalized form of a stored identifier, or nil
+// if it is missing, blank or rejected.
+func normalizeStored(value *string, fn func(string) (string, error)) *string {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil
+	}
+	normalized, err := fn(*value)
+	if err != nil {
+		return nil
+	}
+	return &normalized
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// maxChainDepth bounds FlattenLinkChains so a linked_id cycle cannot make it
+// loop forever. Each pass halves the length of every chain.
+const maxChainDepth = 32
+
+// FlattenLinkChains repairs multi-hop chains left behind by older merges,
+// re-pointing every contact whose linked_id refers to another linked
+// contact at the root of its chain, in one transaction. It returns the
+// number of rows updated.
+func (r *ContactRepository) FlattenLinkChains() (int, error) {
+	updated := 0
+	err := r.WithTx(func(repo *ContactRepository) error {
+		if err := repo.LockAll(); err != nil {
+			return err
+		}
+		var err error
+		updated, err = repo.flattenLinkChains()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+func (r *ContactRepository) flattenLinkChains() (int, error) {
+	chained := `
+		SELECT child.id, child.linked_id, child.link_precedence, parent.linked_id
+		FROM contacts child
+		JOIN contacts parent ON parent.id = child.linked_id
+		WHERE parent.linked_id IS NOT NULL
+	`
+	query := `
+		UPDATE contacts
+		SET linked_id = (SELECT parent.linked_id FROM contacts parent WHERE parent.id = contacts.linked_id),
+			updated_at = ?
+		WHERE linked_id IN (SELECT id FROM contacts WHERE linked_id IS NOT NULL)
+	`
+
+	total := 0
+	for pass := 0; pass < maxChainDepth; pass++ {
+		now := time.Now()
+		if err := r.recordChainEvents(chained, now); err != nil {
+			return total, err
+		}
+
+		result, err := r.conn.Exec(query, now)
+		if err != nil {
+			return total, err
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		if updated == 0 {
+			return total, nil
+		}
+		total += int(updated)
+	}
+
+	return total, fmt.Errorf("link chains still present after %d passes, contacts table may contain a linked_id cycle", maxChainDepth)
+}
+
+// recordChainEvents records a linked event for every contact a pass of
+// flattenLinkChains is about to re-point at its grandparent.
+func (r *ContactRepository) recordChainEvents(query string, at time.Time) error {
+	rows, err := r.conn.Query(query)
+	if err != nil {
+		return err
+	}
+
+	type hop struct {
+		id       int
+		before   linkState
+		linkedID *int
+	}
+	var hops []hop
+	for rows.Next() {
+		var h hop
+		if err := rows.Scan(&h.id, &h.before.linkedID, &h.before.linkPrecedence, &h.linkedID); err != nil {
+			rows.Close()
+			return err
+		}
+		hops = append(hops, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, h := range hops {
+		if err := r.recordEvent(h.id, models.EventLinked, &h.before, h.linkedID, h.before.linkPrecedence, at); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *ContactRepository) FindByID(id int) (*models.Contact, error) {
-    query := `
-        SELECT id, phone_number, email, linked_id, link_precedence, created_at, updated_at, deleted_at
-        FROM contacts 
-        WHERE id = ? AND deleted_at IS NULL
-    `
-    
-    var contact models.Contact
-    err := r.db.QueryRow(query, id).Scan(
-        &contact.ID,
-        &contact.PhoneNumber,
-        &contact.Email,
-        &contact.LinkedID,
-        &contact.LinkPrecedence,
-        &contact.CreatedAt,
-        &contact.UpdatedAt,
-        &contact.DeletedAt,
-    )
-
-	if err != nil {
-        if err == sql.ErrNoRows {
-            return nil, nil
-        }
-        return nil, err
-    }
-
-    return &contact, nil
-}
\ No newline at end of file
+	query := `
+		SELECT id, phone_number, email, COALESCE(phone_normalized, phone_number), COALESCE(email_normalized, email), linked_id, link_precedence, created_at, updated_at, deleted_at
+		FROM contacts
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	var contact models.Contact
+	err := scanContact(r.conn.QueryRow(query, id), &contact)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &contact, nil
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanContact(row scanner, contact *models.Contact) error {
+	return row.Scan(
+		&contact.ID,
+		&contact.PhoneNumber,
+		&contact.Email,
+		&contact.NormalizedPhoneNumber,
+		&contact.NormalizedEmail,
+		&contact.LinkedID,
+		&contact.LinkPrecedence,
+		&contact.CreatedAt,
+		&contact.UpdatedAt,
+		&contact.DeletedAt,
+	)
+}
+
+func scanContacts(rows *sql.Rows) ([]models.Contact, error) {
+	var contacts []models.Contact
+	for rows.Next() {
+		var contact models.Contact
+		if err := scanContact(rows, &contact); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+
+	return contacts, rows.Err()
+}
@@ -0,0 +1,206 @@
+package database_test
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"bitespeed-identity-reconciliation/internal/database/dbtest"
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/normalize"
+	"reflect"
+	"testing"
+)
+
+func TestContactRepository_FlattenLinkChains(t *testing.T) {
+	db := dbtest.Open(t)
+	repo := database.NewContactRepository(db)
+
+	// 4 -> 3 -> 2 -> 1 and 5 -> 3, as left behind by repeated merges that
+	// only demoted primaries.
+	dbtest.Exec(t, db, `
+		INSERT INTO contacts (id, email, linked_id, link_precedence) VALUES
+			(1, 'a@example.com', NULL, 'primary'),
+			(2, 'b@example.com', 1, 'secondary'),
+			(3, 'c@example.com', 2, 'secondary'),
+			(4, 'd@example.com', 3, 'secondary'),
+			(5, 'e@example.com', 3, 'secondary'),
+			(6, 'f@example.com', NULL, 'primary'),
+			(7, 'g@example.com', 6, 'secondary');
+	`)
+
+	updated, err := repo.FlattenLinkChains()
+	if err != nil {
+		t.Fatalf("FlattenLinkChains() error = %v", err)
+	}
+	if updated == 0 {
+		t.Error("Expected FlattenLinkChains() to update rows")
+	}
+
+	var events int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contact_events WHERE event_type = 'linked'`).Scan(&events); err != nil {
+		t.Fatalf("Failed to count events: %v", err)
+	}
+	if events != updated {
+		t.Errorf("Expected %d linked events, got %d", updated, events)
+	}
+
+	want := map[int]int{2: 1, 3: 1, 4: 1, 5: 1, 7: 6}
+	for id, linkedID := range want {
+		var got int
+		if err := db.QueryRow(`SELECT linked_id FROM contacts WHERE id = $1`, id).Scan(&got); err != nil {
+			t.Fatalf("Failed to read contact %d: %v", id, err)
+		}
+		if got != linkedID {
+			t.Errorf("Contact %d: expected linked_id %d, got %d", id, linkedID, got)
+		}
+	}
+
+	updated, err = repo.FlattenLinkChains()
+	if err != nil {
+		t.Fatalf("FlattenLinkChains() error = %v", err)
+	}
+	if updated != 0 {
+		t.Errorf("Expected second run to be a no-op, updated %d rows", updated)
+	}
+}
+
+func TestContactRepository_FlattenLinkChainsCycle(t *testing.T) {
+	db := dbtest.Open(t)
+	repo := database.NewContactRepository(db)
+
+	dbtest.Exec(t, db, `
+		INSERT INTO contacts (id, email, linked_id, link_precedence) VALUES
+			(1, 'a@example.com', 2, 'secondary'),
+			(2, 'b@example.com', 1, 'secondary');
+	`)
+
+	if _, err := repo.FlattenLinkChains(); err == nil {
+		t.Error("Expected error for linked_id cycle but got none")
+	}
+
+	// The passes made before giving up are rolled back.
+	var events int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contact_events`).Scan(&events); err != nil {
+		t.Fatalf("Failed to count events: %v", err)
+	}
+	if events != 0 {
+		t.Errorf("Expected no events after a failed run, got %d", events)
+	}
+}
+
+func TestContactRepository_RecordsEvents(t *testing.T) {
+	db := dbtest.Open(t)
+	repo := database.NewContactRepository(db)
+
+	first := &models.Contact{Email: stringPtr("a@example.com"), LinkPrecedence: "primary"}
+	second := &models.Contact{Email: stringPtr("b@example.com"), LinkPrecedence: "primary"}
+	for _, contact := range []*models.Contact{first, second} {
+		if err := repo.Create(contact); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	steps := []func() error{
+		func() error { return repo.UpdateLinkPrecedence(second.ID, &first.ID, "secondary") },
+		// Unchanged links are not recorded.
+		func() error { return repo.UpdateLinkPrecedence(second.ID, &first.ID, "secondary") },
+		func() error { return repo.DetachContact(second.ID, nil, "primary") },
+		func() error { return repo.SoftDelete(second.ID) },
+		// Deleted contacts are neither changed nor recorded.
+		func() error { return repo.UpdateLinkPrecedence(second.ID, &first.ID, "secondary") },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("Step %d: %v", i, err)
+		}
+	}
+
+	events, err := repo.FindEventsByContactID(second.ID)
+	if err != nil {
+		t.Fatalf("FindEventsByContactID() error = %v", err)
+	}
+
+	want := []string{models.EventCreated, models.EventDemoted, models.EventSplit, models.EventDeleted}
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Type)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected events %v, got %v", want, got)
+	}
+
+	demoted := events[1]
+	if demoted.PreviousLinkPrecedence == nil || *demoted.PreviousLinkPrecedence != "primary" ||
+		demoted.LinkedID == nil || *demoted.LinkedID != first.ID {
+		t.Errorf("Unexpected demotion event %+v", demoted)
+	}
+}
+
+func TestContactRepository_Renormalize(t *testing.T) {
+	db := dbtest.Open(t)
+	repo := database.NewContactRepository(db)
+
+	dbtest.Exec(t, db, `
+		INSERT INTO contacts (id, email, phone_number, link_precedence) VALUES
+			(1, 'Doc@HillValley.edu ', '+1 (555) 010-0000', 'primary'),
+			(2, NULL, 'not a phone', 'primary'),
+			(3, NULL, '555 010 0001', 'primary');
+	`)
+
+	n, err := normalize.New(normalize.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	updated, err := repo.Renormalize(n)
+	if err != nil {
+		t.Fatalf("Renormalize() error = %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 contacts to be normalized, got %d", updated)
+	}
+
+	contacts, err := repo.FindByEmailOrPhone(stringPtr("doc@hillvalley.edu"), stringPtr("+15550100000"))
+	if err != nil {
+		t.Fatalf("FindByEmailOrPhone() error = %v", err)
+	}
+	if len(contacts) != 1 || contacts[0].ID != 1 {
+		t.Fatalf("Expected normalized contact 1 to match, got %v", contacts)
+	}
+
+	// Rejected values keep matching on their raw form.
+	contacts, err = repo.FindByEmailOrPhone(nil, stringPtr("not a phone"))
+	if err != nil {
+		t.Fatalf("FindByEmailOrPhone() error = %v", err)
+	}
+	if len(contacts) != 1 || contacts[0].ID != 2 {
+		t.Errorf("Expected contact 2 to match on its raw phone number, got %v", contacts)
+	}
+
+	// The same configuration leaves the rows alone.
+	if updated, err := repo.Renormalize(n); err != nil || updated != 0 {
+		t.Errorf("Expected a second run to do nothing, got %d, %v", updated, err)
+	}
+
+	// A new default country rewrites the numbers stored without one.
+	n, err = normalize.New(normalize.Config{DefaultCountry: "US"})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	updated, err = repo.Renormalize(n)
+	if err != nil {
+		t.Fatalf("Renormalize() error = %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected 1 contact to be normalized again, got %d", updated)
+	}
+	contacts, err = repo.FindByEmailOrPhone(nil, stringPtr("+15550100001"))
+	if err != nil {
+		t.Fatalf("FindByEmailOrPhone() error = %v", err)
+	}
+	if len(contacts) != 1 || contacts[0].ID != 3 {
+		t.Errorf("Expected contact 3 to match in E.164, got %v", contacts)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,21 @@
+-- A contacts.db as created by the first release, before normalization and
+-- before migrations existed.
+CREATE TABLE IF NOT EXISTS contacts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    phone_number TEXT,
+    email TEXT,
+    linked_id INTEGER,
+    link_precedence TEXT NOT NULL CHECK(link_precedence IN ('primary', 'secondary')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    FOREIGN KEY (linked_id) REFERENCES contacts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_phone ON contacts(phone_number) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_email ON contacts(email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_linked_id ON contacts(linked_id) WHERE deleted_at IS NULL;
+
+INSERT INTO contacts (id, phone_number, email, linked_id, link_precedence, created_at, updated_at) VALUES
+    (1, '123456', 'Lorraine@HillValley.edu', NULL, 'primary', '2023-04-01 00:00:00', '2023-04-01 00:00:00'),
+    (23, '123456', 'mcfly@hillvalley.edu', 1, 'secondary', '2023-04-20 05:30:00', '2023-04-20 05:30:00');
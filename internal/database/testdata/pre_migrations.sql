@@ -0,0 +1,90 @@
+-- A contacts.db as created by createTables just before migrations were
+-- introduced: normalized identifiers, tombstones, do-not-link rules, the
+-- blocklist, merges and contact history, but no schema_migrations.
+CREATE TABLE IF NOT EXISTS contacts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    phone_number TEXT,
+    email TEXT,
+    phone_normalized TEXT,
+    email_normalized TEXT,
+    linked_id INTEGER,
+    link_precedence TEXT NOT NULL CHECK(link_precedence IN ('primary', 'secondary')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    FOREIGN KEY (linked_id) REFERENCES contacts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_phone ON contacts(phone_number) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_email ON contacts(email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_linked_id ON contacts(linked_id) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS identity_tombstones (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    identifier_hash TEXT NOT NULL UNIQUE,
+    receipt_id TEXT NOT NULL,
+    erased_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS link_exclusions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    contact_id INTEGER NOT NULL,
+    excluded_contact_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (contact_id, excluded_contact_id)
+);
+CREATE INDEX IF NOT EXISTS idx_link_exclusions_excluded ON link_exclusions(excluded_contact_id);
+
+CREATE TABLE IF NOT EXISTS identifier_blocklist (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL CHECK(type IN ('email', 'phone')),
+    value TEXT NOT NULL,
+    reason TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (type, value)
+);
+
+CREATE TABLE IF NOT EXISTS merges (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    primary_contact_id INTEGER NOT NULL,
+    triggered_by TEXT NOT NULL,
+    last_event_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    reverted_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS merge_contacts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    merge_id INTEGER NOT NULL REFERENCES merges(id),
+    contact_id INTEGER NOT NULL,
+    previous_linked_id INTEGER,
+    previous_link_precedence TEXT,
+    linked_id INTEGER,
+    link_precedence TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_merge_contacts_merge_id ON merge_contacts(merge_id);
+
+CREATE TABLE IF NOT EXISTS contact_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    contact_id INTEGER NOT NULL,
+    event_type TEXT NOT NULL,
+    previous_linked_id INTEGER,
+    previous_link_precedence TEXT,
+    linked_id INTEGER,
+    link_precedence TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_contact_events_contact_id ON contact_events(contact_id);
+
+CREATE INDEX IF NOT EXISTS idx_phone_normalized ON contacts(COALESCE(phone_normalized, phone_number)) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_email_normalized ON contacts(COALESCE(email_normalized, email)) WHERE deleted_at IS NULL;
+
+INSERT INTO contacts (id, phone_number, email, phone_normalized, email_normalized, linked_id, link_precedence, created_at, updated_at) VALUES
+    (1, '123456', 'Lorraine@HillValley.edu', '123456', 'lorraine@hillvalley.edu', NULL, 'primary', '2023-04-01 00:00:00', '2023-04-01 00:00:00'),
+    (23, '123456', 'mcfly@hillvalley.edu', '123456', 'mcfly@hillvalley.edu', 1, 'secondary', '2023-04-20 05:30:00', '2023-04-20 05:30:00');
+
+INSERT INTO contact_events (contact_id, event_type, linked_id, link_precedence, created_at) VALUES
+    (1, 'created', NULL, 'primary', '2023-04-01 00:00:00'),
+    (23, 'created', 1, 'secondary', '2023-04-20 05:30:00');
+
+INSERT INTO identifier_blocklist (type, value, reason) VALUES ('phone', '0000000000', 'test number');
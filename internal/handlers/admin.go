@@ -0,0 +1,18 @@
+package handlers
+
+import "context"
+
+type adminKey struct{}
+
+// WithAdmin returns a copy of ctx naming the admin who authenticated the
+// request, for handlers that record who made a change.
+func WithAdmin(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, adminKey{}, name)
+}
+
+// AdminFrom returns the admin WithAdmin stored in ctx, or "" for requests
+// that were not authenticated.
+func AdminFrom(ctx context.Context) string {
+	name, _ := ctx.Value(adminKey{}).(string)
+	return name
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/internal/validation"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+	"unicode"
+)
+
+// maxBatchItems and maxBatchBytes cap a JSON array batch, which is read
+// whole before anything is written. NDJSON batches are streamed, so they
+// get higher caps, and each line is held to the size of a single request.
+const (
+	maxBatchItems  = 10000
+	maxBatchBytes  = 16 << 20
+	maxStreamBytes = 64 << 20
+)
+
+// maxStreamItems caps the requests of an NDJSON batch, and
+// streamIdleTimeout is how long one may wait for its next line, or for its
+// results to be written. The timeout replaces the server's read and write
+// timeouts, which would cut off any stream longer than them, so a stalled
+// client still cannot hold a stream open indefinitely. Both are variables
+// so tests can lower them.
+var (
+	maxStreamItems    = 100000
+	streamIdleTimeout = 10 * time.Second
+)
+
+// batchWriteTimeout is how long writing the results of a JSON array batch
+// may take once they are ready. Reconciling a large batch can outlast the
+// server's write timeout, which would drop results that are already
+// committed, so the deadline is moved past it.
+const batchWriteTimeout = 30 * time.Second
+
+var errStreamTooLong = errors.New("batch has too many requests")
+
+// Batch serves POST /identify/batch. The body is either a JSON array of
+// identify requests, answered with a BatchIdentifyResponse once all of them
+// are done, or NDJSON with one request per line, answered with one
+// BatchIdentifyResult per line as each chunk is committed. A request that
+// fails gets an error result and the rest of the batch goes ahead.
+func (h *IdentifyHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	body := bufio.NewReader(r.Body)
+	first, err := firstNonSpace(body)
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("request body is empty")
+		}
+		utils.WriteError(w, http.StatusBadRequest, err,
+			"Invalid batch")
+		return
+	}
+
+	if first == '[' {
+		h.batchArray(w, r, http.MaxBytesReader(w, io.NopCloser(body), maxBatchBytes))
+	} else {
+		h.batchNDJSON(w, r, body)
+	}
+}
+
+func (h *IdentifyHandler) batchArray(w http.ResponseWriter, r *http.Request, body io.Reader) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&items); err != nil {
+		utils.RespondError(w, utils.JSONError(err), "Invalid batch")
+		return
+	}
+	if len(items) > maxBatchItems {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("batch has %d requests, the limit is %d", len(items), maxBatchItems),
+			"Batch too large, send it as NDJSON instead")
+		return
+	}
+
+	response := models.BatchIdentifyResponse{Results: h.identifyBatch(r.Context(), 0, items)}
+	for _, result := range response.Results {
+		if result.Status == http.StatusOK {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(batchWriteTimeout))
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *IdentifyHandler) batchNDJSON(w http.ResponseWriter, r *http.Request, body io.Reader) {
+	// Results are written while the rest of the body is still being read.
+	rc := http.NewResponseController(w)
+	rc.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+	encoder := json.NewEncoder(w)
+	// A failed read cancels the request context, and the lines received
+	// before it are still reconciled.
+	ctx := context.WithoutCancel(r.Context())
+
+	index := 0
+	var chunk []json.RawMessage
+	flush := func() {
+		results := h.identifyBatch(ctx, index, chunk)
+		rc.SetWriteDeadline(time.Now().Add(streamIdleTimeout))
+		for _, result := range results {
+			encoder.Encode(result)
+		}
+		rc.Flush()
+		index += len(chunk)
+		chunk = chunk[:0]
+	}
+
+	body = http.MaxBytesReader(w, io.NopCloser(body), maxStreamBytes)
+	scanner := bufio.NewScanner(idleReader{body, rc})
+	scanner.Buffer(nil, validation.MaxBodyBytes)
+	var err error
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if index+len(chunk) == maxStreamItems {
+			err = fmt.Errorf("%w, the limit is %d", errStreamTooLong, maxStreamItems)
+			break
+		}
+		chunk = append(chunk, json.RawMessage(bytes.Clone(line)))
+		if len(chunk) == services.BatchChunkSize {
+			flush()
+		}
+	}
+	if len(chunk) > 0 {
+		flush()
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+
+	if err != nil {
+		rc.SetWriteDeadline(time.Now().Add(streamIdleTimeout))
+		encoder.Encode(batchError(index, streamErrorStatus(err), err,
+			"Failed to read request body, the remaining requests were not processed"))
+	}
+}
+
+// idleReader gives every read of an NDJSON batch streamIdleTimeout from
+// the moment it starts.
+type idleReader struct {
+	io.Reader
+	rc *http.ResponseController
+}
+
+func (r idleReader) Read(p []byte) (int, error) {
+	r.rc.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+	return r.Reader.Read(p)
+}
+
+// streamErrorStatus returns the status of the error that ended an NDJSON
+// batch early.
+func streamErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return http.StatusRequestTimeout
+	case errors.As(err, &maxBytesErr), errors.Is(err, errStreamTooLong):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// identifyBatch decodes items and reconciles the valid ones under ctx.
+// offset is the position of the first item in the whole batch.
+func (h *IdentifyHandler) identifyBatch(ctx context.Context, offset int, items []json.RawMessage) []models.BatchIdentifyResult {
+	results := make([]models.BatchIdentifyResult, len(items))
+
+	var reqs []*models.IdentifyRequest
+	var positions []int
+	for i, item := range items {
+		var req models.IdentifyRequest
+		err := validation.Unmarshal(item, &req)
+		if err == nil {
+			err = validation.IdentifyRequest(&req)
+		}
+		if err != nil {
+			results[i] = batchError(offset+i, utils.ErrorStatus(err), err,
+				"Invalid identity request")
+			continue
+		}
+		reqs = append(reqs, &req)
+		positions = append(positions, i)
+	}
+
+	for j, result := range h.identityService.WithContext(ctx).IdentifyBatch(reqs) {
+		i := positions[j]
+		if result.Err != nil {
+			results[i] = batchError(offset+i, utils.ErrorStatus(result.Err), result.Err,
+				"Failed to process identity request")
+			continue
+		}
+		results[i] = models.BatchIdentifyResult{
+			Index:   offset + i,
+			Status:  http.StatusOK,
+			Contact: &result.Response.Contact,
+		}
+	}
+
+	return results
+}
+
+func batchError(index, status int, err error, message string) models.BatchIdentifyResult {
+	response := utils.NewErrorResponse(status, err, message)
+	return models.BatchIdentifyResult{
+		Index:         index,
+		Status:        status,
+		ErrorResponse: &response,
+	}
+}
+
+// firstNonSpace skips leading whitespace and returns the next byte without
+// consuming it.
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(rune(b)) {
+			return b, r.UnreadByte()
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdentifyHandler_Batch(t *testing.T) {
+	requests := []string{
+		`{"email": "doc@hillvalley.edu", "phoneNumber": 123456}`,
+		`{"phoneNumber": true}`,
+		`{}`,
+		`{"email": "marty@hillvalley.edu", "phoneNumber": "123456"}`,
+	}
+	wantStatus := []int{http.StatusOK, http.StatusBadRequest, http.StatusBadRequest, http.StatusOK}
+
+	checkResults := func(t *testing.T, results []models.BatchIdentifyResult) {
+		t.Helper()
+		if len(results) != len(wantStatus) {
+			t.Fatalf("Expected %d results, got %+v", len(wantStatus), results)
+		}
+		for i, result := range results {
+			if result.Index != i || result.Status != wantStatus[i] {
+				t.Errorf("Result %d: expected index %d and status %d, got %+v", i, i, wantStatus[i], result)
+			}
+		}
+		if contact := results[3].Contact; contact == nil || len(contact.Emails) != 2 {
+			t.Errorf("Expected the last request to join the first, got %+v", contact)
+		}
+	}
+
+	t.Run("JSON array", func(t *testing.T) {
+		handler := NewIdentifyHandler(newTestService(t))
+		w := httptest.NewRecorder()
+		handler.Batch(w, httptest.NewRequest(http.MethodPost, "/identify/batch",
+			strings.NewReader(" ["+strings.Join(requests, ",")+"]")))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var response models.BatchIdentifyResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		checkResults(t, response.Results)
+		if response.Succeeded != 2 || response.Failed != 2 {
+			t.Errorf("Expected 2 succeeded and 2 failed, got %d and %d", response.Succeeded, response.Failed)
+		}
+	})
+
+	t.Run("NDJSON", func(t *testing.T) {
+		handler := NewIdentifyHandler(newTestService(t))
+		w := httptest.NewRecorder()
+		handler.Batch(w, httptest.NewRequest(http.MethodPost, "/identify/batch",
+			strings.NewReader(strings.Join(requests, "\n\n")+"\n")))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+			t.Errorf("Expected NDJSON, got %q", contentType)
+		}
+		var results []models.BatchIdentifyResult
+		decoder := json.NewDecoder(w.Body)
+		for decoder.More() {
+			var result models.BatchIdentifyResult
+			if err := decoder.Decode(&result); err != nil {
+				t.Fatalf("Failed to decode result: %v", err)
+			}
+			results = append(results, result)
+		}
+		checkResults(t, results)
+	})
+}
+
+func TestIdentifyHandler_BatchRejectsBody(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"Empty body", "  ", http.StatusBadRequest},
+		{"Malformed array", `[{"email": "doc@hillvalley.edu"`, http.StatusBadRequest},
+		{"Too many requests", "[" + strings.Repeat(`{},`, maxBatchItems) + "{}]", http.StatusRequestEntityTooLarge},
+	}
+
+	handler := NewIdentifyHandler(newTestService(t))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.Batch(w, httptest.NewRequest(http.MethodPost, "/identify/batch", strings.NewReader(tt.body)))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdentifyHandler_BatchOutlastsWriteTimeout(t *testing.T) {
+	handler := NewIdentifyHandler(newTestService(t))
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stands in for a batch that takes longer to reconcile than the
+		// server may take to write.
+		time.Sleep(200 * time.Millisecond)
+		handler.Batch(w, r)
+	}))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json",
+		strings.NewReader(`[{"email": "doc@hillvalley.edu"}]`))
+	if err != nil {
+		t.Fatalf("Expected the results despite the write timeout, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	var response models.BatchIdentifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Succeeded != 1 {
+		t.Errorf("Expected 1 succeeded request, got %+v", response)
+	}
+}
+
+func TestIdentifyHandler_BatchStreamLimits(t *testing.T) {
+	readResults := func(t *testing.T, body io.Reader) []models.BatchIdentifyResult {
+		t.Helper()
+		var results []models.BatchIdentifyResult
+		decoder := json.NewDecoder(body)
+		for decoder.More() {
+			var result models.BatchIdentifyResult
+			if err := decoder.Decode(&result); err != nil {
+				t.Fatalf("Failed to decode result: %v", err)
+			}
+			results = append(results, result)
+		}
+		return results
+	}
+
+	t.Run("Too many requests", func(t *testing.T) {
+		defer func(limit int) { maxStreamItems = limit }(maxStreamItems)
+		maxStreamItems = 5
+
+		handler := NewIdentifyHandler(newTestService(t))
+		w := httptest.NewRecorder()
+		handler.Batch(w, httptest.NewRequest(http.MethodPost, "/identify/batch",
+			strings.NewReader(strings.Repeat("{}\n", maxStreamItems+1))))
+
+		results := readResults(t, w.Body)
+		if len(results) != maxStreamItems+1 {
+			t.Fatalf("Expected %d results, got %d", maxStreamItems+1, len(results))
+		}
+		if last := results[maxStreamItems]; last.Index != maxStreamItems || last.Status != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected the batch to end with a 413, got %+v", last)
+		}
+	})
+
+	t.Run("Stalled client", func(t *testing.T) {
+		defer func(timeout time.Duration) { streamIdleTimeout = timeout }(streamIdleTimeout)
+		streamIdleTimeout = 100 * time.Millisecond
+
+		server := httptest.NewServer(http.HandlerFunc(NewIdentifyHandler(newTestService(t)).Batch))
+		defer server.Close()
+
+		// The client sends one request and then nothing, without closing
+		// the body.
+		body, bodyWriter := io.Pipe()
+		defer bodyWriter.Close()
+		go io.WriteString(bodyWriter, `{"email": "doc@hillvalley.edu"}`+"\n")
+
+		resp, err := http.Post(server.URL, "application/x-ndjson", body)
+		if err != nil {
+			t.Fatalf("Batch request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		done := make(chan []models.BatchIdentifyResult)
+		go func() { done <- readResults(t, resp.Body) }()
+		select {
+		case results := <-done:
+			if len(results) != 2 || results[0].Status != http.StatusOK || results[1].Status != http.StatusRequestTimeout {
+				t.Errorf("Expected a result and then a 408, got %+v", results)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the stalled stream to be cut off")
+		}
+	})
+}
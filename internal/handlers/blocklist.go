@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/internal/validation"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"net/http"
+	"strconv"
+)
+
+// BlocklistHandler serves the admin API for identifiers that must never
+// link contacts, under /blocklist.
+type BlocklistHandler struct {
+	identityService *services.IdentityService
+}
+
+func NewBlocklistHandler(identityService *services.IdentityService) *BlocklistHandler {
+	return &BlocklistHandler{
+		identityService: identityService,
+	}
+}
+
+// List serves GET /blocklist.
+func (h *BlocklistHandler) List(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.identityService.WithContext(r.Context()).ListBlockedIdentifiers()
+	if err != nil {
+		utils.RespondError(w, err, "Failed to load blocklist")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, entries)
+}
+
+// Create serves POST /blocklist.
+func (h *BlocklistHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req models.BlockedIdentifier
+	if err := validation.Decode(w, r, &req, validation.MaxBodyBytes); err != nil {
+		utils.RespondError(w, err, "Invalid blocklist entry")
+		return
+	}
+
+	entry, err := h.identityService.WithContext(r.Context()).BlockIdentifier(&req)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to save blocklist entry")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, entry)
+}
+
+// Delete serves DELETE /blocklist/{id}.
+func (h *BlocklistHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err,
+			"Blocklist ID must be an integer")
+		return
+	}
+
+	if err := h.identityService.WithContext(r.Context()).UnblockIdentifier(id); err != nil {
+		utils.RespondError(w, err, "Failed to delete blocklist entry")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
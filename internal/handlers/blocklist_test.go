@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBlocklistHandler(t *testing.T) {
+	service := newTestService(t)
+	identifyHandler := NewIdentifyHandler(service)
+	blocklistHandler := NewBlocklistHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identify", identifyHandler.Identify)
+	mux.HandleFunc("GET /blocklist", blocklistHandler.List)
+	mux.HandleFunc("POST /blocklist", blocklistHandler.Create)
+	mux.HandleFunc("DELETE /blocklist/{id}", blocklistHandler.Delete)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"Create", http.MethodPost, "/blocklist", `{"type": "phone", "value": "5550000000", "reason": "test number"}`, http.StatusCreated},
+		{"Duplicate", http.MethodPost, "/blocklist", `{"type": "phone", "value": "5550000000"}`, http.StatusConflict},
+		{"Invalid type", http.MethodPost, "/blocklist", `{"type": "fax", "value": "5550000000"}`, http.StatusBadRequest},
+		{"Invalid JSON", http.MethodPost, "/blocklist", `{"type": `, http.StatusBadRequest},
+		{"Unknown field", http.MethodPost, "/blocklist", `{"type": "phone", "value": "5551111111", "note": "test number"}`, http.StatusBadRequest},
+		{"Blocklisted identifier only", http.MethodPost, "/identify", `{"phoneNumber": "5550000000"}`, http.StatusBadRequest},
+		{"Invalid ID", http.MethodDelete, "/blocklist/abc", "", http.StatusBadRequest},
+		{"Unknown ID", http.MethodDelete, "/blocklist/99", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(tt.method, tt.path, tt.body); w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := serve(http.MethodGet, "/blocklist", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var entries []models.BlockedIdentifier
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("Failed to decode blocklist: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Value != "5550000000" || entries[0].Reason == nil {
+		t.Fatalf("Unexpected blocklist %+v", entries)
+	}
+
+	if w := serve(http.MethodDelete, "/blocklist/1", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := serve(http.MethodPost, "/identify", `{"phoneNumber": "5550000000"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d once unblocked, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
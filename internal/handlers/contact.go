@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"net/http"
+	"strconv"
+)
+
+type ContactHandler struct {
+	identityService *services.IdentityService
+}
+
+func NewContactHandler(identityService *services.IdentityService) *ContactHandler {
+	return &ContactHandler{
+		identityService: identityService,
+	}
+}
+
+// GetContact serves GET /contacts/{id}.
+func (h *ContactHandler) GetContact(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err,
+			"Contact ID must be an integer")
+		return
+	}
+
+	response, err := h.identityService.WithContext(r.Context()).GetContact(id)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to load contact")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// DeleteContact serves DELETE /contacts/{id}.
+func (h *ContactHandler) DeleteContact(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err,
+			"Contact ID must be an integer")
+		return
+	}
+
+	if err := h.identityService.WithContext(r.Context()).DeleteContact(id); err != nil {
+		utils.RespondError(w, err, "Failed to delete contact")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetHistory serves GET /contacts/{id}/history.
+func (h *ContactHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err,
+			"Contact ID must be an integer")
+		return
+	}
+
+	response, err := h.identityService.WithContext(r.Context()).GetContactHistory(id)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to load contact history")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
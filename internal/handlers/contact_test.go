@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContactHandler_GetContact(t *testing.T) {
+	service := newTestService(t)
+	identifyHandler := NewIdentifyHandler(service)
+	contactHandler := NewContactHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identify", identifyHandler.Identify)
+	mux.HandleFunc("GET /contacts/{id}", contactHandler.GetContact)
+
+	for _, body := range []string{
+		`{"email": "lorraine@hillvalley.edu", "phoneNumber": "123456"}`,
+		`{"email": "mcfly@hillvalley.edu", "phoneNumber": "123456"}`,
+		`{"email": "biff@hillvalley.edu", "phoneNumber": "717171"}`,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to seed contact: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	if err := service.DeleteContact(3); err != nil {
+		t.Fatalf("Failed to soft-delete contact: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		path             string
+		expectedStatus   int
+		expectedPrimary  int
+		expectedContacts int
+	}{
+		{
+			name:             "Primary contact",
+			path:             "/contacts/1",
+			expectedStatus:   http.StatusOK,
+			expectedPrimary:  1,
+			expectedContacts: 2,
+		},
+		{
+			name:             "Secondary contact resolves to its primary",
+			path:             "/contacts/2",
+			expectedStatus:   http.StatusOK,
+			expectedPrimary:  1,
+			expectedContacts: 2,
+		},
+		{
+			name:           "Unknown contact",
+			path:           "/contacts/99",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Soft-deleted contact",
+			path:           "/contacts/3",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Non-numeric ID",
+			path:           "/contacts/abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.ContactDetailsResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Contact.PrimaryContactID != tt.expectedPrimary {
+				t.Errorf("Expected primary %d, got %d", tt.expectedPrimary, response.Contact.PrimaryContactID)
+			}
+			if len(response.Contacts) != tt.expectedContacts {
+				t.Errorf("Expected %d contact rows, got %d", tt.expectedContacts, len(response.Contacts))
+			}
+		})
+	}
+}
+
+func TestContactHandler_DeleteContact(t *testing.T) {
+	service := newTestService(t)
+	identifyHandler := NewIdentifyHandler(service)
+	contactHandler := NewContactHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identify", identifyHandler.Identify)
+	mux.HandleFunc("GET /contacts/{id}", contactHandler.GetContact)
+	mux.HandleFunc("DELETE /contacts/{id}", contactHandler.DeleteContact)
+
+	for _, body := range []string{
+		`{"email": "lorraine@hillvalley.edu", "phoneNumber": "123456"}`,
+		`{"email": "mcfly@hillvalley.edu", "phoneNumber": "123456"}`,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to seed contact: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/contacts/1", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/contacts/1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a deleted contact, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/contacts/2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response models.ContactDetailsResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Contact.PrimaryContactID != 2 {
+		t.Errorf("Expected contact 2 to be promoted, got primary %d", response.Contact.PrimaryContactID)
+	}
+}
+
+func TestContactHandler_GetHistory(t *testing.T) {
+	service := newTestService(t)
+	identifyHandler := NewIdentifyHandler(service)
+	contactHandler := NewContactHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identify", identifyHandler.Identify)
+	mux.HandleFunc("GET /contacts/{id}/history", contactHandler.GetHistory)
+
+	for _, body := range []string{
+		`{"email": "lorraine@hillvalley.edu", "phoneNumber": "123456"}`,
+		`{"email": "mcfly@hillvalley.edu", "phoneNumber": "123456"}`,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to seed contact: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedEvents int
+	}{
+		{"Secondary contact", "/contacts/2/history", http.StatusOK, 1},
+		{"Invalid ID", "/contacts/abc/history", http.StatusBadRequest, 0},
+		{"Unknown contact", "/contacts/99/history", http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.ContactHistoryResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Events) != tt.expectedEvents {
+				t.Fatalf("Expected %d events, got %+v", tt.expectedEvents, response.Events)
+			}
+			event := response.Events[0]
+			if event.Type != models.EventCreated || event.LinkedID == nil || *event.LinkedID != 1 {
+				t.Errorf("Unexpected event %+v", event)
+			}
+		})
+	}
+}
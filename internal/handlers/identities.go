@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/internal/validation"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"net/http"
+	"strconv"
+)
+
+// IdentitiesHandler serves the administrative operations on whole
+// identities under /identities.
+type IdentitiesHandler struct {
+	identityService *services.IdentityService
+}
+
+func NewIdentitiesHandler(identityService *services.IdentityService) *IdentitiesHandler {
+	return &IdentitiesHandler{
+		identityService: identityService,
+	}
+}
+
+// Erase serves POST /identities/{primaryId}/erase.
+func (h *IdentitiesHandler) Erase(w http.ResponseWriter, r *http.Request) {
+	primaryID, err := strconv.Atoi(r.PathValue("primaryId"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err,
+			"Primary contact ID must be an integer")
+		return
+	}
+
+	receipt, err := h.identityService.WithContext(r.Context()).EraseIdentity(primaryID)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to erase identity")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, receipt)
+}
+
+// Split serves POST /identities/{primaryId}/split.
+func (h *IdentitiesHandler) Split(w http.ResponseWriter, r *http.Request) {
+	primaryID, err := strconv.Atoi(r.PathValue("primaryId"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err,
+			"Primary contact ID must be an integer")
+		return
+	}
+
+	var req models.SplitRequest
+	if err := validation.Decode(w, r, &req, validation.MaxBodyBytes); err != nil {
+		utils.RespondError(w, err, "Invalid split request")
+		return
+	}
+
+	response, err := h.identityService.WithContext(r.Context()).SplitIdentity(primaryID, req.ContactIDs)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to split identity")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// Merge serves POST /identities/merge. The merge is recorded as triggered by
+// the admin who authenticated the request.
+func (h *IdentitiesHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	admin := AdminFrom(r.Context())
+	if admin == "" {
+		utils.WriteError(w, http.StatusUnauthorized, nil,
+			"A valid admin token is required")
+		return
+	}
+
+	var req models.MergeRequest
+	if err := validation.Decode(w, r, &req, validation.MaxBodyBytes); err != nil {
+		utils.RespondError(w, err, "Invalid merge request")
+		return
+	}
+
+	response, err := h.identityService.WithContext(r.Context()).MergeIdentities(req.PrimaryIDs, admin)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to merge identities")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/validation"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdentitiesHandler_Erase(t *testing.T) {
+	service := newTestService(t)
+	identifyHandler := NewIdentifyHandler(service)
+	identitiesHandler := NewIdentitiesHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identify", identifyHandler.Identify)
+	mux.HandleFunc("POST /identities/{primaryId}/erase", identitiesHandler.Erase)
+
+	identify := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(body)))
+		return w
+	}
+
+	if w := identify(`{"email": "lorraine@hillvalley.edu", "phoneNumber": "123456"}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to seed contact: %d %s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identities/1/erase", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var receipt models.ErasureReceipt
+	if err := json.NewDecoder(w.Body).Decode(&receipt); err != nil {
+		t.Fatalf("Failed to decode receipt: %v", err)
+	}
+	if receipt.PrimaryContactID != 1 || len(receipt.ErasedContactIDs) != 1 {
+		t.Errorf("Unexpected receipt %+v", receipt)
+	}
+
+	if w := identify(`{"email": "lorraine@hillvalley.edu"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for an erased identifier, got %d", http.StatusConflict, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identities/1/erase", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an erased identity, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestIdentitiesHandler_Split(t *testing.T) {
+	service := newTestService(t)
+	identifyHandler := NewIdentifyHandler(service)
+	identitiesHandler := NewIdentitiesHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identify", identifyHandler.Identify)
+	mux.HandleFunc("POST /identities/{primaryId}/split", identitiesHandler.Split)
+
+	for _, body := range []string{
+		`{"email": "lorraine@hillvalley.edu", "phoneNumber": "555"}`,
+		`{"email": "marty@hillvalley.edu", "phoneNumber": "555"}`,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to seed contact: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"Invalid ID", "/identities/abc/split", `{"contactIds": [2]}`, http.StatusBadRequest},
+		{"Invalid JSON", "/identities/1/split", `{"contactIds": `, http.StatusBadRequest},
+		{"Unknown field", "/identities/1/split", `{"contactId": [2]}`, http.StatusBadRequest},
+		{"Too large", "/identities/1/split", `{"contactIds": [` + strings.Repeat("2, ", validation.MaxBodyBytes/3) + `2]}`, http.StatusRequestEntityTooLarge},
+		{"Unknown identity", "/identities/99/split", `{"contactIds": [2]}`, http.StatusNotFound},
+		{"Every contact", "/identities/1/split", `{"contactIds": [1, 2]}`, http.StatusBadRequest},
+		{"Split", "/identities/1/split", `{"contactIds": [2]}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response models.SplitResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Original.PrimaryContactID != 1 || response.Split.PrimaryContactID != 2 {
+				t.Errorf("Unexpected response %+v", response)
+			}
+		})
+	}
+}
+
+func TestIdentitiesHandler_Merge(t *testing.T) {
+	service := newTestService(t)
+	identifyHandler := NewIdentifyHandler(service)
+	identitiesHandler := NewIdentitiesHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identify", identifyHandler.Identify)
+	mux.HandleFunc("POST /identities/merge", identitiesHandler.Merge)
+
+	for _, body := range []string{
+		`{"email": "lorraine@hillvalley.edu"}`,
+		`{"email": "calvin@kleinmail.com"}`,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to seed contact: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		admin      string
+		wantStatus int
+	}{
+		{"Invalid JSON", `{"primaryIds": `, "jane", http.StatusBadRequest},
+		{"Unknown field", `{"primaryIds": [1, 2], "reason": "duplicate"}`, "jane", http.StatusBadRequest},
+		{"Attribution in the body", `{"primaryIds": [1, 2], "triggeredBy": "someone-else"}`, "jane", http.StatusBadRequest},
+		{"Too large", `{"primaryIds": [1, ` + strings.Repeat(" ", validation.MaxBodyBytes) + `2]}`, "jane", http.StatusRequestEntityTooLarge},
+		{"No admin", `{"primaryIds": [1, 2]}`, "", http.StatusUnauthorized},
+		{"Unknown identity", `{"primaryIds": [1, 99]}`, "jane", http.StatusNotFound},
+		{"Merge", `{"primaryIds": [2, 1]}`, "jane", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/identities/merge", strings.NewReader(tt.body))
+			if tt.admin != "" {
+				req = req.WithContext(WithAdmin(req.Context(), tt.admin))
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response models.MergeResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.MergeID == 0 || response.Contact.PrimaryContactID != 1 ||
+				len(response.Contact.SecondaryContactIDs) != 1 || response.Contact.SecondaryContactIDs[0] != 2 {
+				t.Errorf("Unexpected response %+v", response)
+			}
+		})
+	}
+}
@@ -2,41 +2,62 @@ package handlers
 
 import (
 	"bitespeed-identity-reconciliation/internal/models"
-    "bitespeed-identity-reconciliation/internal/services"
-    "bitespeed-identity-reconciliation/pkg/utils"
-    "net/http"
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/internal/validation"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"net/http"
 )
 
 type IdentifyHandler struct {
-    identityService *services.IdentityService
+	identityService *services.IdentityService
 }
 
-func NewIdentifyHandler() *IdentifyHandler {
-    return &IdentifyHandler{
-        identityService: services.NewIdentityService(),
-    }
+func NewIdentifyHandler(identityService *services.IdentityService) *IdentifyHandler {
+	return &IdentifyHandler{
+		identityService: identityService,
+	}
 }
 
+// Identify serves POST /identify.
 func (h *IdentifyHandler) Identify(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost {
-        utils.WriteError(w, http.StatusMethodNotAllowed, 
-            nil, "Method not allowed. Use POST.")
-        return
-    }
+	var req models.IdentifyRequest
+	if err := decodeIdentifyRequest(w, r, &req); err != nil {
+		utils.RespondError(w, err, "Invalid identity request")
+		return
+	}
+
+	response, err := h.identityService.WithContext(r.Context()).IdentifyContact(&req)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to process identity request")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
 
+// Lookup serves POST /identify/lookup: the same matching as Identify, but
+// nothing is written. The response lists the writes Identify would make.
+func (h *IdentifyHandler) Lookup(w http.ResponseWriter, r *http.Request) {
 	var req models.IdentifyRequest
-    if err := utils.ParseJSON(r, &req); err != nil {
-        utils.WriteError(w, http.StatusBadRequest, err, 
-            "Invalid JSON in request body")
-        return
-    }
-
-	response, err := h.identityService.IdentifyContact(&req)
-    if err != nil {
-        utils.WriteError(w, http.StatusBadRequest, err, 
-            "Failed to process identity request")
-        return
-    }
+	if err := decodeIdentifyRequest(w, r, &req); err != nil {
+		utils.RespondError(w, err, "Invalid identity request")
+		return
+	}
+
+	response, err := h.identityService.WithContext(r.Context()).LookupContact(&req)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to look up identity")
+		return
+	}
 
 	utils.WriteJSON(w, http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+// decodeIdentifyRequest reads an identify request from the body of r and
+// validates it.
+func decodeIdentifyRequest(w http.ResponseWriter, r *http.Request, req *models.IdentifyRequest) error {
+	if err := validation.Decode(w, r, req, validation.MaxBodyBytes); err != nil {
+		return err
+	}
+	return validation.IdentifyRequest(req)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/normalize"
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIdentifyHandler_PhoneNumberFormats(t *testing.T) {
+	handler := NewIdentifyHandler(newTestService(t))
+
+	tests := []struct {
+		name             string
+		body             string
+		expectedStatus   int
+		expectedPhones   []string
+		expectedErrorHas string
+	}{
+		{
+			name:           "Phone number as JSON number",
+			body:           `{"email": "lorraine@hillvalley.edu", "phoneNumber": 123456}`,
+			expectedStatus: http.StatusOK,
+			expectedPhones: []string{"123456"},
+		},
+		{
+			name:           "Phone number as JSON string",
+			body:           `{"email": "mcfly@hillvalley.edu", "phoneNumber": "123456"}`,
+			expectedStatus: http.StatusOK,
+			expectedPhones: []string{"123456"},
+		},
+		{
+			name:           "Null phone number",
+			body:           `{"email": "lorraine@hillvalley.edu", "phoneNumber": null}`,
+			expectedStatus: http.StatusOK,
+			expectedPhones: []string{"123456"},
+		},
+		{
+			name:             "Fractional phone number",
+			body:             `{"phoneNumber": 1234.5}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedErrorHas: "phoneNumber must be",
+		},
+		{
+			name:             "Phone number with exponent",
+			body:             `{"phoneNumber": 1e6}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedErrorHas: "phoneNumber must be",
+		},
+		{
+			name:             "Negative phone number",
+			body:             `{"phoneNumber": -123456}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedErrorHas: "phoneNumber must be",
+		},
+		{
+			name:             "Boolean phone number",
+			body:             `{"phoneNumber": true}`,
+			expectedStatus:   http.StatusBadRequest,
+			expectedErrorHas: "phoneNumber must be",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.Identify(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if tt.expectedErrorHas != "" {
+				if !strings.Contains(w.Body.String(), tt.expectedErrorHas) {
+					t.Errorf("Expected error containing %q, got %s", tt.expectedErrorHas, w.Body.String())
+				}
+				return
+			}
+
+			var response models.IdentifyResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(response.Contact.PhoneNumbers, tt.expectedPhones) {
+				t.Errorf("Expected phone numbers %v, got %v", tt.expectedPhones, response.Contact.PhoneNumbers)
+			}
+		})
+	}
+}
+
+func TestIdentifyHandler_Lookup(t *testing.T) {
+	handler := NewIdentifyHandler(newTestService(t))
+
+	w := httptest.NewRecorder()
+	handler.Lookup(w, httptest.NewRequest(http.MethodPost, "/identify/lookup",
+		strings.NewReader(`{"email": "doc@hillvalley.edu", "phoneNumber": 123456}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response models.LookupResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Writes) != 1 || response.Writes[0].Operation != models.WriteCreate {
+		t.Errorf("Expected a single planned create, got %+v", response.Writes)
+	}
+
+	w = httptest.NewRecorder()
+	handler.Lookup(w, httptest.NewRequest(http.MethodPost, "/identify/lookup",
+		strings.NewReader(`{"email": "doc@hillvalley.edu"}`)))
+
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Writes) != 1 {
+		t.Errorf("Expected the first lookup to have stored nothing, got %+v", response.Writes)
+	}
+}
+
+func TestIdentifyHandler_Errors(t *testing.T) {
+	handler := NewIdentifyHandler(newTestService(t))
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+		expectedCode   string
+		expectedFields []string
+	}{
+		{"Malformed JSON", http.MethodPost, `{"email":`, http.StatusBadRequest, "invalid_json", nil},
+		{"Wrong type", http.MethodPost, `{"email": 42}`, http.StatusBadRequest, "invalid_json", []string{"email"}},
+		{"No identifiers", http.MethodPost, `{}`, http.StatusBadRequest, "invalid_request", []string{"email", "phoneNumber"}},
+		{"Unusable phone number", http.MethodPost, `{"phoneNumber": "call me"}`, http.StatusBadRequest, "invalid_request", []string{"phoneNumber"}},
+		{"Every invalid field", http.MethodPost, `{"email": "doc@", "phoneNumber": "12"}`, http.StatusBadRequest, "invalid_request", []string{"email", "phoneNumber"}},
+		{"Unknown field", http.MethodPost, `{"email": "doc@hillvalley.edu", "name": "Doc"}`, http.StatusBadRequest, "invalid_json", []string{"name"}},
+		{"Oversized body", http.MethodPost, `{"email": "` + strings.Repeat("a", 1<<20) + `"}`, http.StatusRequestEntityTooLarge, "request_too_large", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.Identify(w, httptest.NewRequest(tt.method, "/identify", strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			var response utils.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, response.Code)
+			}
+			var fields []string
+			for _, detail := range response.Details {
+				fields = append(fields, detail.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.expectedFields) {
+				t.Errorf("Expected details for %v, got %+v", tt.expectedFields, response.Details)
+			}
+		})
+	}
+}
+
+// newTestService returns a service backed by an empty in-memory store.
+func newTestService(t *testing.T) *services.IdentityService {
+	t.Helper()
+
+	normalizer, err := normalize.New(normalize.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	return services.NewIdentityService(services.NewMemoryStore(), normalizer, testErasureKey)
+}
+
+// testErasureKey is a key long enough to enable identity erasure.
+var testErasureKey = []byte(strings.Repeat("k", services.MinErasureKeyLength))
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"net/http"
+	"strconv"
+)
+
+// MergesHandler serves the recorded merges under /merges.
+type MergesHandler struct {
+	identityService *services.IdentityService
+}
+
+func NewMergesHandler(identityService *services.IdentityService) *MergesHandler {
+	return &MergesHandler{
+		identityService: identityService,
+	}
+}
+
+// Revert serves POST /merges/{mergeId}/revert.
+func (h *MergesHandler) Revert(w http.ResponseWriter, r *http.Request) {
+	mergeID, err := strconv.Atoi(r.PathValue("mergeId"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err,
+			"Merge ID must be an integer")
+		return
+	}
+
+	response, err := h.identityService.WithContext(r.Context()).RevertMerge(mergeID)
+	if err != nil {
+		utils.RespondError(w, err, "Failed to revert merge")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMergesHandler_Revert(t *testing.T) {
+	service := newTestService(t)
+	identifyHandler := NewIdentifyHandler(service)
+	identitiesHandler := NewIdentitiesHandler(service)
+	mergesHandler := NewMergesHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identify", identifyHandler.Identify)
+	mux.HandleFunc("POST /identities/merge", identitiesHandler.Merge)
+	mux.HandleFunc("POST /merges/{mergeId}/revert", mergesHandler.Revert)
+
+	serve := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req.WithContext(WithAdmin(req.Context(), "jane")))
+		return w
+	}
+
+	for _, body := range []string{
+		`{"email": "lorraine@hillvalley.edu"}`,
+		`{"email": "calvin@kleinmail.com"}`,
+	} {
+		if w := serve("/identify", body); w.Code != http.StatusOK {
+			t.Fatalf("Failed to seed contact: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if w := serve("/identities/merge", `{"primaryIds": [1, 2]}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to merge: %d %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"Invalid ID", "/merges/abc/revert", http.StatusBadRequest},
+		{"Unknown merge", "/merges/99/revert", http.StatusNotFound},
+		{"Revert", "/merges/1/revert", http.StatusOK},
+		{"Already reverted", "/merges/1/revert", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.path, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response models.RevertResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Identities) != 2 {
+				t.Errorf("Expected 2 restored identities, got %+v", response.Identities)
+			}
+		})
+	}
+}
@@ -1,23 +1,31 @@
 package models
 
 import (
+	"bitespeed-identity-reconciliation/pkg/utils"
 	"time"
 )
 
 type Contact struct {
-	ID             int        `json:"id" db:"id"`
-	PhoneNumber    *string    `json:"phoneNumber" db:"phone_number"`
-	Email          *string    `json:"email" db:"email"`
-	LinkedID       *int       `json:"linkedId" db:"linked_id"`
-	LinkPrecedence string     `json:"linkPrecedence" db:"link_precedence"`
-	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
-	DeletedAt      *time.Time `json:"deletedAt" db:"deleted_at"`
+	ID                    int          `json:"id" db:"id"`
+	PhoneNumber           *PhoneNumber `json:"phoneNumber" db:"phone_number"`
+	Email                 *string      `json:"email" db:"email"`
+	NormalizedPhoneNumber *string      `json:"normalizedPhoneNumber" db:"phone_normalized"`
+	NormalizedEmail       *string      `json:"normalizedEmail" db:"email_normalized"`
+	LinkedID              *int         `json:"linkedId" db:"linked_id"`
+	LinkPrecedence        string       `json:"linkPrecedence" db:"link_precedence"`
+	CreatedAt             time.Time    `json:"createdAt" db:"created_at"`
+	UpdatedAt             time.Time    `json:"updatedAt" db:"updated_at"`
+	DeletedAt             *time.Time   `json:"deletedAt" db:"deleted_at"`
 }
 
+// IdentifyRequest carries the identifiers as received. The normalized
+// fields are filled in by the service before any lookup and are what
+// matching uses.
 type IdentifyRequest struct {
-	Email       *string `json:"email"`
-	PhoneNumber *string `json:"phoneNumber"`
+	Email                 *string      `json:"email"`
+	PhoneNumber           *PhoneNumber `json:"phoneNumber"`
+	NormalizedEmail       *string      `json:"-"`
+	NormalizedPhoneNumber *string      `json:"-"`
 }
 
 type IdentifyResponse struct {
@@ -30,3 +38,167 @@ type ContactInfo struct {
 	PhoneNumbers        []string `json:"phoneNumbers"`
 	SecondaryContactIDs []int    `json:"secondaryContactIds"`
 }
+
+// ContactDetailsResponse is the consolidated identity a contact belongs to,
+// together with the contact rows it was built from.
+type ContactDetailsResponse struct {
+	Contact  ContactInfo `json:"contact"`
+	Contacts []Contact   `json:"contacts"`
+}
+
+// Write operations reported in ContactWrite.
+const (
+	WriteCreate = "create"
+	WriteUpdate = "update"
+)
+
+// ContactWrite describes one change reconciliation makes to the contacts
+// table, or would make when run as a lookup. ContactID is zero for contacts
+// that have not been created.
+type ContactWrite struct {
+	Operation      string       `json:"operation"`
+	ContactID      int          `json:"contactId,omitempty"`
+	Email          *string      `json:"email,omitempty"`
+	PhoneNumber    *PhoneNumber `json:"phoneNumber,omitempty"`
+	LinkedID       *int         `json:"linkedId"`
+	LinkPrecedence string       `json:"linkPrecedence"`
+}
+
+// LookupResponse is returned by a read-only identify: the identity the
+// request resolves to and the writes a real identify would perform.
+type LookupResponse struct {
+	Contact ContactInfo    `json:"contact"`
+	Writes  []ContactWrite `json:"writes"`
+}
+
+// BatchIdentifyResult is the outcome of one request in a batch identify.
+// Index is the request's position in the batch and Status the HTTP status
+// the request would have got from /identify on its own. A failed request
+// carries the fields of the error response instead of a contact.
+type BatchIdentifyResult struct {
+	Index   int          `json:"index"`
+	Status  int          `json:"status"`
+	Contact *ContactInfo `json:"contact,omitempty"`
+	*utils.ErrorResponse
+}
+
+// BatchIdentifyResponse holds the results of a batch identify in request
+// order.
+type BatchIdentifyResponse struct {
+	Results   []BatchIdentifyResult `json:"results"`
+	Succeeded int                   `json:"succeeded"`
+	Failed    int                   `json:"failed"`
+}
+
+// ErasureReceipt is the audit record of an identity erasure. Only keyed
+// hashes of the erased identifiers are kept.
+type ErasureReceipt struct {
+	ReceiptID        string    `json:"receiptId"`
+	PrimaryContactID int       `json:"primaryContactId"`
+	ErasedContactIDs []int     `json:"erasedContactIds"`
+	IdentifierHashes []string  `json:"identifierHashes"`
+	ErasedAt         time.Time `json:"erasedAt"`
+}
+
+// SplitRequest names the contacts to detach from an identity.
+type SplitRequest struct {
+	ContactIDs []int `json:"contactIds"`
+}
+
+// SplitResponse holds the two identities left after a split.
+type SplitResponse struct {
+	Original ContactInfo `json:"original"`
+	Split    ContactInfo `json:"split"`
+}
+
+// Identifier types a BlockedIdentifier can hold.
+const (
+	IdentifierEmail = "email"
+	IdentifierPhone = "phone"
+)
+
+// BlockedIdentifier is an email or phone number shared by too many unrelated
+// customers to be used for matching, such as a store's front desk number.
+// Value holds the normalized identifier.
+type BlockedIdentifier struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	Reason    *string   `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// MergeRequest asks for two identities to be merged by hand. The merge is
+// recorded as triggered by the admin who sent it.
+type MergeRequest struct {
+	PrimaryIDs []int `json:"primaryIds"`
+}
+
+// MergeTriggeredByIdentify is the TriggeredBy of merges made by /identify.
+const MergeTriggeredByIdentify = "identify"
+
+// Merge is the record of one merge of clusters: the winning primary, who
+// triggered it and the link of every contact it touched before and after.
+type Merge struct {
+	ID               int            `json:"id"`
+	PrimaryContactID int            `json:"primaryContactId"`
+	TriggeredBy      string         `json:"triggeredBy"`
+	Contacts         []MergeContact `json:"contacts"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	RevertedAt       *time.Time     `json:"revertedAt"`
+	// LastEventID is the newest contact event when the merge was recorded.
+	LastEventID int `json:"-"`
+}
+
+// MergeContact is the change a merge made to one contact. A contact
+// created by the merge has no previous link precedence.
+type MergeContact struct {
+	ContactID              int     `json:"contactId"`
+	PreviousLinkedID       *int    `json:"previousLinkedId"`
+	PreviousLinkPrecedence *string `json:"previousLinkPrecedence"`
+	LinkedID               *int    `json:"linkedId"`
+	LinkPrecedence         string  `json:"linkPrecedence"`
+}
+
+// RevertResponse lists the identities restored by reverting a merge.
+type RevertResponse struct {
+	MergeID    int           `json:"mergeId"`
+	Identities []ContactInfo `json:"identities"`
+}
+
+// MergeResponse is the identity left after a manual merge.
+type MergeResponse struct {
+	MergeID int         `json:"mergeId"`
+	Contact ContactInfo `json:"contact"`
+}
+
+// Contact event types recorded in the contact history.
+const (
+	EventCreated  = "created"
+	EventLinked   = "linked"
+	EventDemoted  = "demoted"
+	EventPromoted = "promoted"
+	EventSplit    = "split"
+	EventDeleted  = "deleted"
+	EventErased   = "erased"
+	EventReverted = "reverted"
+)
+
+// ContactEvent is one entry in a contact's history: how its link changed
+// and what it was before. Events never hold emails or phone numbers.
+type ContactEvent struct {
+	ID                     int       `json:"id"`
+	ContactID              int       `json:"contactId"`
+	Type                   string    `json:"type"`
+	PreviousLinkedID       *int      `json:"previousLinkedId"`
+	PreviousLinkPrecedence *string   `json:"previousLinkPrecedence"`
+	LinkedID               *int      `json:"linkedId"`
+	LinkPrecedence         *string   `json:"linkPrecedence"`
+	CreatedAt              time.Time `json:"createdAt"`
+}
+
+// ContactHistoryResponse is the timeline of a contact, oldest event first.
+type ContactHistoryResponse struct {
+	ContactID int            `json:"contactId"`
+	Events    []ContactEvent `json:"events"`
+}
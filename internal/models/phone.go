@@ -0,0 +1,42 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// PhoneNumber is a phone number as sent by the client. The spec types it as
+// a JSON number, but clients also send it as a string, so both forms are
+// accepted. Numbers must be written as plain integers: fractions and
+// exponents cannot be told apart from data loss and are rejected.
+type PhoneNumber string
+
+func (p *PhoneNumber) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return fmt.Errorf("phoneNumber must be a string or an integer")
+	}
+
+	switch c := data[0]; {
+	case c == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*p = PhoneNumber(s)
+		return nil
+	case c >= '0' && c <= '9':
+		for _, d := range data {
+			if d < '0' || d > '9' {
+				return fmt.Errorf("phoneNumber must be a string or an integer without sign, fraction or exponent, got %s", data)
+			}
+		}
+		*p = PhoneNumber(data)
+		return nil
+	case c == '-':
+		return fmt.Errorf("phoneNumber must be a string or an integer without sign, fraction or exponent, got %s", data)
+	default:
+		return fmt.Errorf("phoneNumber must be a string or an integer, got %s", data)
+	}
+}
@@ -0,0 +1,242 @@
+// Package normalize canonicalises emails and phone numbers so that different
+// spellings of the same identifier are matched as one.
+package normalize
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Func is a single normalization stage. Stages run in order, each receiving
+// the output of the previous one.
+type Func func(value string) (string, error)
+
+// Normalizer runs an ordered pipeline of stages for emails and for phone
+// numbers. Extra stages can be appended to either slice.
+type Normalizer struct {
+	Email []Func
+	Phone []Func
+	// Version names the pipeline. Stored identifiers are normalized again
+	// when it changes, so a pipeline given extra stages should set its own.
+	Version string
+}
+
+type Config struct {
+	// FoldGmail removes dots and "+tag" suffixes from Gmail local parts.
+	FoldGmail bool
+	// DefaultCountry is the ISO 3166 alpha-2 code assumed for phone numbers
+	// written without an international prefix. When empty such numbers are
+	// reduced to their digits.
+	DefaultCountry string
+}
+
+// New builds the standard pipeline for cfg.
+func New(cfg Config) (*Normalizer, error) {
+	n := &Normalizer{
+		Email:   []Func{TrimLower},
+		Version: cfg.version(),
+	}
+	if cfg.FoldGmail {
+		n.Email = append(n.Email, FoldGmail)
+	}
+
+	phone, err := E164(cfg.DefaultCountry)
+	if err != nil {
+		return nil, err
+	}
+	n.Phone = []Func{phone}
+
+	return n, nil
+}
+
+// version identifies the standard pipeline for cfg.
+func (cfg Config) version() string {
+	country := strings.ToUpper(strings.TrimSpace(cfg.DefaultCountry))
+	return fmt.Sprintf("v1 fold_gmail=%t default_country=%s", cfg.FoldGmail, country)
+}
+
+// FromEnv builds the pipeline from EMAIL_FOLD_GMAIL and PHONE_DEFAULT_COUNTRY.
+func FromEnv() *Normalizer {
+	cfg := Config{DefaultCountry: os.Getenv("PHONE_DEFAULT_COUNTRY")}
+	if fold, err := strconv.ParseBool(os.Getenv("EMAIL_FOLD_GMAIL")); err == nil {
+		cfg.FoldGmail = fold
+	}
+
+	n, err := New(cfg)
+	if err != nil {
+		log.Printf("Ignoring PHONE_DEFAULT_COUNTRY: %v", err)
+		cfg.DefaultCountry = ""
+		n, _ = New(cfg)
+	}
+	return n
+}
+
+// FieldError is an identifier Apply could not normalize. Field is its JSON
+// name in the request.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string { return e.Err.Error() }
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// Apply fills in the normalized identifiers of req. Identifiers that are
+// missing or blank stay nil.
+func (n *Normalizer) Apply(req *models.IdentifyRequest) error {
+	req.NormalizedEmail = nil
+	req.NormalizedPhoneNumber = nil
+
+	if req.Email != nil && strings.TrimSpace(*req.Email) != "" {
+		email, err := n.NormalizeEmail(*req.Email)
+		if err != nil {
+			return &FieldError{Field: "email", Err: err}
+		}
+		req.NormalizedEmail = &email
+	}
+
+	if req.PhoneNumber != nil && strings.TrimSpace(string(*req.PhoneNumber)) != "" {
+		phone, err := n.NormalizePhone(string(*req.PhoneNumber))
+		if err != nil {
+			return &FieldError{Field: "phoneNumber", Err: err}
+		}
+		req.NormalizedPhoneNumber = &phone
+	}
+
+	return nil
+}
+
+func (n *Normalizer) NormalizeEmail(email string) (string, error) {
+	return run(n.Email, email)
+}
+
+func (n *Normalizer) NormalizePhone(phoneNumber string) (string, error) {
+	return run(n.Phone, phoneNumber)
+}
+
+func run(stages []Func, value string) (string, error) {
+	var err error
+	for _, stage := range stages {
+		if value, err = stage(value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// TrimLower trims surrounding whitespace and lowercases the address.
+func TrimLower(email string) (string, error) {
+	return strings.ToLower(strings.TrimSpace(email)), nil
+}
+
+// FoldGmail maps the many spellings Gmail delivers to the same inbox onto
+// one: dots and anything after "+" in the local part are dropped, and
+// googlemail.com becomes gmail.com.
+func FoldGmail(email string) (string, error) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email, nil
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if domain != "gmail.com" && domain != "googlemail.com" {
+		return email, nil
+	}
+
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	local = strings.ReplaceAll(local, ".", "")
+
+	return local + "@gmail.com", nil
+}
+
+// callingCodes maps ISO 3166 alpha-2 codes to ITU calling codes for the
+// countries accepted as PHONE_DEFAULT_COUNTRY.
+var callingCodes = map[string]string{
+	"AE": "971",
+	"AU": "61",
+	"BR": "55",
+	"CA": "1",
+	"CN": "86",
+	"DE": "49",
+	"ES": "34",
+	"FR": "33",
+	"GB": "44",
+	"IE": "353",
+	"IN": "91",
+	"JP": "81",
+	"MX": "52",
+	"NL": "31",
+	"NZ": "64",
+	"SG": "65",
+	"US": "1",
+	"ZA": "27",
+}
+
+// maxE164Digits is the longest number E.164 allows, country code included.
+const maxE164Digits = 15
+
+// E164 returns a stage that rewrites phone numbers to E.164 ("+15550100000").
+// Spaces, dashes, dots and parentheses are dropped. Numbers starting with
+// "+" or "00" are taken as international; other numbers get the calling
+// code of defaultCountry, after removing a national trunk "0". With no
+// default country, national numbers are reduced to their digits only.
+func E164(defaultCountry string) (Func, error) {
+	country := strings.ToUpper(strings.TrimSpace(defaultCountry))
+	code, ok := callingCodes[country]
+	if country != "" && !ok {
+		return nil, fmt.Errorf("unsupported default country %q", defaultCountry)
+	}
+
+	return func(phoneNumber string) (string, error) {
+		value := strings.TrimSpace(phoneNumber)
+
+		international := false
+		switch {
+		case strings.HasPrefix(value, "+"):
+			international = true
+			value = value[1:]
+		case strings.HasPrefix(value, "00"):
+			international = true
+			value = value[2:]
+		}
+
+		var digits strings.Builder
+		for _, r := range value {
+			switch {
+			case r >= '0' && r <= '9':
+				digits.WriteRune(r)
+			case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+			default:
+				return "", fmt.Errorf("invalid phone number %q: unexpected character %q", phoneNumber, r)
+			}
+		}
+
+		number := digits.String()
+		if number == "" {
+			return "", fmt.Errorf("invalid phone number %q: no digits", phoneNumber)
+		}
+
+		if !international {
+			if code == "" {
+				return number, nil
+			}
+			if code == "1" && len(number) == 11 && strings.HasPrefix(number, "1") {
+				// North American numbers are often written with a leading 1.
+				number = number[1:]
+			}
+			number = code + strings.TrimPrefix(number, "0")
+		}
+
+		if len(number) > maxE164Digits {
+			return "", fmt.Errorf("invalid phone number %q: more than %d digits", phoneNumber, maxE164Digits)
+		}
+
+		return "+" + number, nil
+	}, nil
+}
@@ -0,0 +1,170 @@
+package normalize
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		foldGmail bool
+		email     string
+		want      string
+	}{
+		{
+			name:  "Trims and lowercases",
+			email: " Doc@HillValley.edu ",
+			want:  "doc@hillvalley.edu",
+		},
+		{
+			name:  "Keeps Gmail dots without folding",
+			email: "Doc.Brown+kart@gmail.com",
+			want:  "doc.brown+kart@gmail.com",
+		},
+		{
+			name:      "Folds Gmail dots and tags",
+			foldGmail: true,
+			email:     "Doc.Brown+kart@GoogleMail.com",
+			want:      "docbrown@gmail.com",
+		},
+		{
+			name:      "Leaves other domains alone when folding",
+			foldGmail: true,
+			email:     "doc.brown+kart@hillvalley.edu",
+			want:      "doc.brown+kart@hillvalley.edu",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := New(Config{FoldGmail: tt.foldGmail})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			got, err := n.NormalizeEmail(tt.email)
+			if err != nil {
+				t.Fatalf("NormalizeEmail() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.email, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name           string
+		defaultCountry string
+		phoneNumber    string
+		want           string
+		expectError    bool
+	}{
+		{
+			name:        "International format",
+			phoneNumber: "+1 (555) 010-0000",
+			want:        "+15550100000",
+		},
+		{
+			name:        "00 international prefix",
+			phoneNumber: "0044 20 7946 0000",
+			want:        "+442079460000",
+		},
+		{
+			name:        "National number without default country",
+			phoneNumber: "555-010-0000",
+			want:        "5550100000",
+		},
+		{
+			name:           "National number with default country",
+			defaultCountry: "US",
+			phoneNumber:    "5550100000",
+			want:           "+15550100000",
+		},
+		{
+			name:           "North American number with leading 1",
+			defaultCountry: "us",
+			phoneNumber:    "1 555 010 0000",
+			want:           "+15550100000",
+		},
+		{
+			name:           "Trunk prefix is dropped",
+			defaultCountry: "GB",
+			phoneNumber:    "020 7946 0000",
+			want:           "+442079460000",
+		},
+		{
+			name:        "Letters are rejected",
+			phoneNumber: "555-CALL-DOC",
+			expectError: true,
+		},
+		{
+			name:        "Too many digits are rejected",
+			phoneNumber: "+1234567890123456",
+			expectError: true,
+		},
+		{
+			name:        "Punctuation only is rejected",
+			phoneNumber: "()-",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := New(Config{DefaultCountry: tt.defaultCountry})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			got, err := n.NormalizePhone(tt.phoneNumber)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizePhone() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizePhone(%q) = %q, want %q", tt.phoneNumber, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_UnknownDefaultCountry(t *testing.T) {
+	if _, err := New(Config{DefaultCountry: "XX"}); err == nil {
+		t.Error("Expected error for unknown default country but got none")
+	}
+}
+
+func TestNormalizer_Apply(t *testing.T) {
+	n, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	n.Email = append(n.Email, func(email string) (string, error) {
+		return "custom:" + email, nil
+	})
+
+	email := " Marty@HillValley.edu"
+	blank := models.PhoneNumber("  ")
+	req := &models.IdentifyRequest{Email: &email, PhoneNumber: &blank}
+	if err := n.Apply(req); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	if req.NormalizedEmail == nil || *req.NormalizedEmail != "custom:marty@hillvalley.edu" {
+		t.Errorf("Expected custom stage to run after built-in ones, got %v", req.NormalizedEmail)
+	}
+	if req.NormalizedPhoneNumber != nil {
+		t.Errorf("Expected blank phone number to stay unset, got %q", *req.NormalizedPhoneNumber)
+	}
+	if *req.Email != " Marty@HillValley.edu" {
+		t.Errorf("Expected raw email to be preserved, got %q", *req.Email)
+	}
+}
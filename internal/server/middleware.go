@@ -0,0 +1,270 @@
+package server
+
+import (
+	"bitespeed-identity-reconciliation/internal/handlers"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a handler with behaviour shared by every route.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in middlewares, the first of which runs first.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// RequestIDHeader carries the ID of a request, both ways.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID gives every request an ID, taken from its X-Request-ID header
+// when the client or a proxy set one and generated otherwise. The ID is
+// stored in the request's context and echoed in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFrom returns the ID RequestID gave the request of ctx, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether id is safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder remembers the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streamed responses can still be flushed.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Logging logs one line per request once it has been answered.
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		log.Printf("%s %s %d %dB %s request_id=%s",
+			r.Method, r.URL.Path, status, recorder.bytes,
+			time.Since(start).Round(time.Microsecond), RequestIDFrom(r.Context()))
+	})
+}
+
+// Recover answers a request whose handler panicked with a JSON 500 instead
+// of dropping the connection, and logs the panic with its stack and the
+// request ID. A panic after the response has started cannot be answered, so
+// the connection is aborted to show the client the response is incomplete.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			log.Printf("Panic serving %s %s request_id=%s: %v\n%s",
+				r.Method, r.URL.Path, RequestIDFrom(r.Context()), v, debug.Stack())
+			if recorder.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			utils.WriteError(w, http.StatusInternalServerError, nil,
+				"Internal server error")
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// CORS lets browsers on allowedOrigins call the API. "*" allows every
+// origin, and no origins disables CORS. Preflight requests are answered
+// here and never reach the routes.
+func CORS(allowedOrigins []string) Middleware {
+	allowAll := slices.Contains(allowedOrigins, "*")
+
+	return func(next http.Handler) http.Handler {
+		if len(allowedOrigins) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			if !allowAll {
+				header.Add("Vary", "Origin")
+			}
+			origin := r.Header.Get("Origin")
+			if origin == "" || !allowAll && !slices.Contains(allowedOrigins, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if allowAll {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			header.Set("Access-Control-Expose-Headers", RequestIDHeader)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				header.Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+				header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+RequestIDHeader)
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int((12 * time.Hour).Seconds())))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout answers a request whose handler is still running after d with a
+// 503. The request's context is cancelled, which rolls back the handler's
+// transaction, and whatever the handler writes afterwards is dropped.
+// Responses are buffered until the handler returns, so routes that stream
+// must not be wrapped. A zero d disables the timeout.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+
+		body, _ := json.Marshal(utils.NewErrorResponse(http.StatusServiceUnavailable,
+			nil, "Request timed out"))
+		timeout := http.TimeoutHandler(next, d, string(body))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// TimeoutHandler writes its body without a Content-Type. Set
+			// here, it is replaced by the handler's own when there is no
+			// timeout.
+			w.Header().Set("Content-Type", "application/json")
+			timeout.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MinAdminTokenLength is the shortest admin token accepted, so tokens are
+// too long to guess.
+const MinAdminTokenLength = 32
+
+// AdminAuth lets through only requests carrying one of tokens, which map
+// admin tokens to admin names, in an "Authorization: Bearer <token>" header.
+// Other requests get a 401. With no tokens, every request gets a 403, so
+// admin routes are disabled until tokens are configured. The admin's name is
+// stored in the request's context, where handlers.AdminFrom reads it.
+func AdminAuth(tokens map[string]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(tokens) == 0 {
+				utils.WriteError(w, http.StatusForbidden, nil,
+					"Admin API is disabled, set ADMIN_TOKENS to enable it")
+				return
+			}
+
+			admin, ok := adminFor(tokens, r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				utils.WriteError(w, http.StatusUnauthorized, nil,
+					"A valid admin token is required")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(handlers.WithAdmin(r.Context(), admin)))
+		})
+	}
+}
+
+// adminFor returns the name of the admin whose token r carries. Every token
+// is compared in constant time, so timing does not reveal how close a guess
+// came.
+func adminFor(tokens map[string]string, r *http.Request) (string, bool) {
+	scheme, given, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || given == "" {
+		return "", false
+	}
+
+	var admin string
+	found := false
+	for token, name := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(given)) == 1 {
+			admin, found = name, true
+		}
+	}
+	return admin, found
+}
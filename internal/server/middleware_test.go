@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bitespeed-identity-reconciliation/internal/handlers"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), mark("first"), mark("second"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if want := []string{"first", "second", "handler"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected order %v, got %v", want, order)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFrom(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		keepsOwn bool
+	}{
+		{"Generated", "", false},
+		{"From the client", "checkout-42", true},
+		{"Unsafe", "bad id\n", false},
+		{"Too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if seen == "" || w.Header().Get(RequestIDHeader) != seen {
+				t.Fatalf("Expected the handler and response to share an ID, got %q and %q", seen, w.Header().Get(RequestIDHeader))
+			}
+			if (seen == tt.header) != tt.keepsOwn {
+				t.Errorf("Expected keeping %q to be %v, got ID %q", tt.header, tt.keepsOwn, seen)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	t.Run("Before the response", func(t *testing.T) {
+		logs := captureLog(t)
+		handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var response *utils.ErrorResponse
+			w.Write([]byte(response.Code))
+		}), RequestID, Recover)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "checkout-42")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+		}
+		var response utils.ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Code != "internal_error" {
+			t.Errorf("Expected code internal_error, got %q", response.Code)
+		}
+		if !strings.Contains(logs.String(), "request_id=checkout-42") || !strings.Contains(logs.String(), "middleware_test.go") {
+			t.Errorf("Expected the request ID and stack in the log, got %q", logs.String())
+		}
+	})
+
+	t.Run("After the response started", func(t *testing.T) {
+		captureLog(t)
+		handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("halfway")
+		}))
+
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("Expected the connection to be aborted, got panic %v", v)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected a JSON body, got %q", contentType)
+	}
+	var response utils.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Code != "unavailable" {
+		t.Errorf("Expected code unavailable, got %q", response.Code)
+	}
+}
+
+// captureLog collects what the test logs, instead of printing it.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestAdminAuth(t *testing.T) {
+	token := strings.Repeat("t", MinAdminTokenLength)
+	var seen string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = handlers.AdminFrom(r.Context())
+	})
+
+	tests := []struct {
+		name           string
+		tokens         map[string]string
+		authorization  string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Valid token", map[string]string{token: "jane"}, "Bearer " + token, http.StatusOK, ""},
+		{"Lowercase scheme", map[string]string{token: "jane"}, "bearer " + token, http.StatusOK, ""},
+		{"No token", map[string]string{token: "jane"}, "", http.StatusUnauthorized, "unauthorized"},
+		{"Wrong token", map[string]string{token: "jane"}, "Bearer " + token + "x", http.StatusUnauthorized, "unauthorized"},
+		{"Basic auth", map[string]string{token: "jane"}, "Basic " + token, http.StatusUnauthorized, "unauthorized"},
+		{"Disabled", nil, "Bearer " + token, http.StatusForbidden, "forbidden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = ""
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			AdminAuth(tt.tokens)(handler).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedCode == "" {
+				if seen != "jane" {
+					t.Errorf("Expected the handler to see admin jane, got %q", seen)
+				}
+				return
+			}
+			var response utils.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, response.Code)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); (challenge != "") != (w.Code == http.StatusUnauthorized) {
+				t.Errorf("Expected a challenge only on 401, got %q", challenge)
+			}
+		})
+	}
+}
+
+func TestAdminTokensFromEnv(t *testing.T) {
+	logs := captureLog(t)
+	token := strings.Repeat("t", MinAdminTokenLength)
+	t.Setenv("ADMIN_TOKENS", "jane:"+token+", ,nobody,bob:short,:"+token+"x,identify:"+token+"y")
+
+	tokens := adminTokensFromEnv("ADMIN_TOKENS")
+
+	if want := map[string]string{token: "jane"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Expected tokens %v, got %v", want, tokens)
+	}
+	if strings.Contains(logs.String(), "short") {
+		t.Errorf("Expected rejected tokens to stay out of the log, got %q", logs.String())
+	}
+}
@@ -0,0 +1,204 @@
+// Package server assembles the HTTP API: its routes and the middleware
+// every request passes through.
+package server
+
+import (
+	"bitespeed-identity-reconciliation/internal/handlers"
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the HTTP layer.
+type Config struct {
+	// AllowedOrigins lists the browser origins allowed to call the API;
+	// "*" allows any. CORS is off when it is empty.
+	AllowedOrigins []string
+	// RequestTimeout bounds how long a request may take. Zero means no
+	// limit. Batch requests are never cut off.
+	RequestTimeout time.Duration
+
+	// ReadTimeout, WriteTimeout and IdleTimeout are those of http.Server.
+	// WriteTimeout should be longer than RequestTimeout, or timed out
+	// requests get no answer.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout bounds how long shutdown waits for in-flight requests
+	// and open transactions.
+	ShutdownTimeout time.Duration
+
+	// AdminTokens maps each bearer token accepted on admin routes to the
+	// name of the admin it belongs to. Admin routes are disabled when it is
+	// empty.
+	AdminTokens map[string]string
+}
+
+// DefaultConfig returns the settings used for anything not set in the
+// environment.
+func DefaultConfig() Config {
+	return Config{
+		RequestTimeout:  30 * time.Second,
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    60 * time.Second,
+		IdleTimeout:     120 * time.Second,
+		ShutdownTimeout: 25 * time.Second,
+	}
+}
+
+// ConfigFromEnv reads the Config from CORS_ALLOWED_ORIGINS, a comma-separated
+// list of origins, from REQUEST_TIMEOUT, READ_TIMEOUT, WRITE_TIMEOUT,
+// IDLE_TIMEOUT and SHUTDOWN_TIMEOUT, durations such as "10s", and from
+// ADMIN_TOKENS, a comma-separated list of name:token pairs.
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+		}
+	}
+
+	durationFromEnv("REQUEST_TIMEOUT", &cfg.RequestTimeout)
+	durationFromEnv("READ_TIMEOUT", &cfg.ReadTimeout)
+	durationFromEnv("WRITE_TIMEOUT", &cfg.WriteTimeout)
+	durationFromEnv("IDLE_TIMEOUT", &cfg.IdleTimeout)
+	durationFromEnv("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	cfg.AdminTokens = adminTokensFromEnv("ADMIN_TOKENS")
+
+	return cfg
+}
+
+// adminTokensFromEnv parses the name:token pairs of the environment variable
+// name. Malformed pairs, tokens shorter than MinAdminTokenLength and the
+// name merges made by /identify are recorded under are logged, without the
+// token, and skipped.
+func adminTokensFromEnv(name string) map[string]string {
+	tokens := make(map[string]string)
+	for i, entry := range strings.Split(os.Getenv(name), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		admin, token, ok := strings.Cut(entry, ":")
+		admin, token = strings.TrimSpace(admin), strings.TrimSpace(token)
+		switch {
+		case !ok || admin == "":
+			log.Printf("Ignoring %s entry %d, expected name:token", name, i+1)
+		case admin == models.MergeTriggeredByIdentify:
+			log.Printf("Ignoring %s token of %q, the name is reserved", name, admin)
+		case len(token) < MinAdminTokenLength:
+			log.Printf("Ignoring %s token of %q, it must be at least %d bytes",
+				name, admin, MinAdminTokenLength)
+		default:
+			tokens[token] = admin
+		}
+	}
+	return tokens
+}
+
+// durationFromEnv sets *d from the environment variable name, if it holds a
+// valid duration.
+func durationFromEnv(name string, d *time.Duration) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		log.Printf("Ignoring %s %q, using %s", name, value, *d)
+		return
+	}
+	*d = parsed
+}
+
+// NewRouter returns the whole API as a single handler: every route, wrapped
+// in request IDs, logging, panic recovery, CORS and timeouts, with admin
+// routes behind AdminAuth. Requests that
+// match no route, or use the wrong method, get a JSON error.
+func NewRouter(identityService *services.IdentityService, cfg Config) http.Handler {
+	identifyHandler := handlers.NewIdentifyHandler(identityService)
+	contactHandler := handlers.NewContactHandler(identityService)
+	identitiesHandler := handlers.NewIdentitiesHandler(identityService)
+	blocklistHandler := handlers.NewBlocklistHandler(identityService)
+	mergesHandler := handlers.NewMergesHandler(identityService)
+
+	mux := http.NewServeMux()
+	timeout := Timeout(cfg.RequestTimeout)
+	handle := func(pattern string, handler http.HandlerFunc) {
+		// The timeout runs handlers on a goroutine of their own and re-panics
+		// without their stack, so panics are recovered inside it as well.
+		mux.Handle(pattern, timeout(Recover(handler)))
+	}
+	admin := AdminAuth(cfg.AdminTokens)
+	handleAdmin := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, admin(timeout(Recover(handler))))
+	}
+
+	handle("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	handle("POST /identify", identifyHandler.Identify)
+	handle("POST /identify/lookup", identifyHandler.Lookup)
+	handle("GET /contacts/{id}", contactHandler.GetContact)
+	handle("DELETE /contacts/{id}", contactHandler.DeleteContact)
+	handle("GET /contacts/{id}/history", contactHandler.GetHistory)
+	handleAdmin("POST /identities/merge", identitiesHandler.Merge)
+	handleAdmin("POST /identities/{primaryId}/erase", identitiesHandler.Erase)
+	handleAdmin("POST /identities/{primaryId}/split", identitiesHandler.Split)
+	handleAdmin("POST /merges/{mergeId}/revert", mergesHandler.Revert)
+	handleAdmin("GET /blocklist", blocklistHandler.List)
+	handleAdmin("POST /blocklist", blocklistHandler.Create)
+	handleAdmin("DELETE /blocklist/{id}", blocklistHandler.Delete)
+
+	// Batches stream their results for as long as the body lasts, so they
+	// are not buffered by the timeout.
+	mux.HandleFunc("POST /identify/batch", identifyHandler.Batch)
+
+	return Chain(jsonFallback(mux),
+		RequestID,
+		Logging,
+		Recover,
+		CORS(cfg.AllowedOrigins),
+	)
+}
+
+// jsonFallback answers requests that match no route of mux with a JSON
+// ErrorResponse in place of the mux's plain text.
+func jsonFallback(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// The mux knows whether the path exists for other methods.
+		probe := &statusProbe{header: http.Header{}, status: http.StatusNotFound}
+		handler.ServeHTTP(probe, r)
+		if allow := probe.header.Get("Allow"); allow != "" {
+			w.Header().Set("Allow", allow)
+		}
+		utils.WriteError(w, probe.status, nil,
+			"No route for "+r.Method+" "+r.URL.Path)
+	})
+}
+
+// statusProbe is a ResponseWriter that keeps the headers and status of a
+// response and drops its body.
+type statusProbe struct {
+	header http.Header
+	status int
+}
+
+func (p *statusProbe) Header() http.Header         { return p.header }
+func (p *statusProbe) Write(b []byte) (int, error) { return len(b), nil }
+func (p *statusProbe) WriteHeader(status int)      { p.status = status }
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"bitespeed-identity-reconciliation/internal/database/dbtest"
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/normalize"
+	"bitespeed-identity-reconciliation/internal/services"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRouter(t *testing.T) {
+	router := newTestRouter(t, Config{AdminTokens: map[string]string{testAdminToken: "jane"}})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedCode   string
+		expectedAllow  string
+	}{
+		{"Health", http.MethodGet, "/health", "", http.StatusOK, "", ""},
+		{"Identify", http.MethodPost, "/identify", `{"email": "doc@hillvalley.edu"}`, http.StatusOK, "", ""},
+		{"Contact", http.MethodGet, "/contacts/1", "", http.StatusOK, "", ""},
+		{"Identify with GET", http.MethodGet, "/identify", "", http.StatusMethodNotAllowed, "method_not_allowed", "POST"},
+		{"Contact with PUT", http.MethodPut, "/contacts/1", "", http.StatusMethodNotAllowed, "method_not_allowed", "DELETE, GET, HEAD"},
+		{"Unknown path", http.MethodGet, "/contacts", "", http.StatusNotFound, "not_found", ""},
+		{"Merge without a token", http.MethodPost, "/identities/merge", `{"primaryIds": [1, 2]}`, http.StatusUnauthorized, "unauthorized", ""},
+		{"Erase without a token", http.MethodPost, "/identities/1/erase", "", http.StatusUnauthorized, "unauthorized", ""},
+		{"Split without a token", http.MethodPost, "/identities/1/split", `{"contactIds": [1]}`, http.StatusUnauthorized, "unauthorized", ""},
+		{"Revert without a token", http.MethodPost, "/merges/1/revert", "", http.StatusUnauthorized, "unauthorized", ""},
+		{"Blocklist without a token", http.MethodGet, "/blocklist", "", http.StatusUnauthorized, "unauthorized", ""},
+		{"Blocklist an identifier without a token", http.MethodPost, "/blocklist", `{"type": "phone", "value": "5550000000"}`, http.StatusUnauthorized, "unauthorized", ""},
+		{"Unblock without a token", http.MethodDelete, "/blocklist/1", "", http.StatusUnauthorized, "unauthorized", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Header().Get(RequestIDHeader) == "" {
+				t.Error("Expected a request ID in the response")
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.expectedAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, allow)
+			}
+			if tt.expectedCode == "" {
+				return
+			}
+
+			var response utils.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, response.Code)
+			}
+		})
+	}
+}
+
+func TestNewRouter_CORS(t *testing.T) {
+	router := newTestRouter(t, Config{AllowedOrigins: []string{"https://shop.fluxkart.com"}})
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/identify", nil)
+	preflight.Header.Set("Origin", "https://shop.fluxkart.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, preflight)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d for the preflight, got %d", http.StatusNoContent, w.Code)
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://shop.fluxkart.com" {
+		t.Errorf("Expected the origin to be allowed, got %q", origin)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(`{"email": "doc@hillvalley.edu"}`))
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("Expected no CORS headers for an unknown origin, got %q", origin)
+	}
+}
+
+func TestNewRouter_RecoversPanics(t *testing.T) {
+	logs := captureLog(t)
+	// Without a service, every identify panics on a nil pointer.
+	router := NewRouter(nil, Config{RequestTimeout: time.Second})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify",
+		strings.NewReader(`{"email": "doc@hillvalley.edu"}`)))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusInternalServerError, w.Code, w.Body.String())
+	}
+	var response utils.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Code != "internal_error" {
+		t.Errorf("Expected code internal_error, got %q", response.Code)
+	}
+	// The stack is that of the handler, not of the timeout re-panicking.
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" || !strings.Contains(logs.String(), "request_id="+id) ||
+		!strings.Contains(logs.String(), "(*IdentifyHandler).Identify") {
+		t.Errorf("Expected the request ID and the handler's stack in the log, got %q", logs.String())
+	}
+}
+
+func TestNewRouter_TimeoutRollsBack(t *testing.T) {
+	captureLog(t)
+	normalizer, err := normalize.New(normalize.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	db := dbtest.Open(t)
+	store := stallingStore{ContactStore: services.NewSQLStore(database.NewContactRepository(db))}
+	service := services.NewIdentityService(store, normalizer, nil)
+	router := NewRouter(service, Config{RequestTimeout: 50 * time.Millisecond})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/identify",
+		strings.NewReader(`{"email": "doc@hillvalley.edu"}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusServiceUnavailable, w.Code, w.Body.String())
+	}
+
+	// The handler runs on after the 503; wait for its transaction to end.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := service.Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+
+	var contacts int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts`).Scan(&contacts); err != nil {
+		t.Fatalf("Failed to count contacts: %v", err)
+	}
+	if contacts != 0 {
+		t.Errorf("Expected the timed out request to write nothing, got %d contacts", contacts)
+	}
+}
+
+// stallingStore writes contacts and then waits until the context the store
+// was bound to is done, so a request creating one outlives its timeout.
+type stallingStore struct {
+	services.ContactStore
+	ctx context.Context
+}
+
+func (s stallingStore) WithContext(ctx context.Context) services.ContactStore {
+	return stallingStore{ContactStore: s.ContactStore.WithContext(ctx), ctx: ctx}
+}
+
+func (s stallingStore) WithTx(fn func(store services.ContactStore) error) error {
+	return s.ContactStore.WithTx(func(store services.ContactStore) error {
+		return fn(stallingStore{ContactStore: store, ctx: s.ctx})
+	})
+}
+
+func (s stallingStore) Create(contact *models.Contact) error {
+	if err := s.ContactStore.Create(contact); err != nil {
+		return err
+	}
+	if s.ctx != nil {
+		<-s.ctx.Done()
+	}
+	return nil
+}
+
+func TestNewRouter_AdminRoutes(t *testing.T) {
+	tests := []struct {
+		name           string
+		tokens         map[string]string
+		authorization  string
+		expectedStatus int
+	}{
+		// Erasure has no key in the test router, so an authorized request
+		// gets as far as the handler's 503.
+		{"Admin", map[string]string{testAdminToken: "jane"}, "Bearer " + testAdminToken, http.StatusServiceUnavailable},
+		{"No token", map[string]string{testAdminToken: "jane"}, "", http.StatusUnauthorized},
+		{"Disabled", nil, "Bearer " + testAdminToken, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, Config{AdminTokens: tt.tokens})
+			req := httptest.NewRequest(http.MethodPost, "/identities/1/erase", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// testAdminToken is the admin token of routers made by newTestRouter.
+var testAdminToken = strings.Repeat("a", MinAdminTokenLength)
+
+// newTestRouter returns the API on an in-memory store holding one
+// contact.
+func newTestRouter(t *testing.T, cfg Config) http.Handler {
+	t.Helper()
+
+	normalizer, err := normalize.New(normalize.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	service := services.NewIdentityService(services.NewMemoryStore(), normalizer, nil)
+	email := "lorraine@hillvalley.edu"
+	if _, err := service.IdentifyContact(&models.IdentifyRequest{Email: &email}); err != nil {
+		t.Fatalf("Failed to seed contact: %v", err)
+	}
+
+	return NewRouter(service, cfg)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bitespeed-identity-reconciliation/internal/services"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// readHeaderTimeout bounds how long a client may take to send its headers,
+// whatever ReadTimeout is.
+const readHeaderTimeout = 5 * time.Second
+
+// New returns a server for handler on addr with the timeouts of cfg.
+func New(addr string, handler http.Handler, cfg Config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// Serve accepts connections on listener until ctx is done, then shuts down
+// gracefully: it stops accepting connections, waits for in-flight requests
+// to be answered and then for the service's open transactions, so the store
+// can be closed once Serve returns. Both waits share shutdownTimeout; when
+// it runs out, remaining connections are closed and an error is returned.
+func Serve(ctx context.Context, srv *http.Server, listener net.Listener,
+	service *services.IdentityService, shutdownTimeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down, waiting for in-flight requests...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+		srv.Close()
+	}
+	if err := service.Drain(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
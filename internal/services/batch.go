@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+)
+
+// BatchChunkSize is the number of requests IdentifyBatch reconciles in one
+// transaction.
+const BatchChunkSize = 100
+
+// BatchResult is the outcome of one request in a batch: the identity it
+// resolved to, or the error that rejected it.
+type BatchResult struct {
+	Response *models.IdentifyResponse
+	Err      error
+}
+
+// IdentifyBatch reconciles reqs in order, as if each had been passed to
+// IdentifyContact, and returns one result per request. Requests are
+// committed BatchChunkSize at a time, each in its own savepoint, so a
+// failing request is rolled back on its own and the rest of the batch goes
+// ahead. Later requests see the contacts earlier ones created, including
+// earlier ones in the same chunk.
+func (s *IdentityService) IdentifyBatch(reqs []*models.IdentifyRequest) []BatchResult {
+	results := make([]BatchResult, len(reqs))
+	for start := 0; start < len(reqs); start += BatchChunkSize {
+		end := min(start+BatchChunkSize, len(reqs))
+		s.identifyChunk(reqs[start:end], results[start:end])
+	}
+	return results
+}
+
+func (s *IdentityService) identifyChunk(reqs []*models.IdentifyRequest, results []BatchResult) {
+	var keys []string
+	for i, req := range reqs {
+		if err := s.prepareRequest(req); err != nil {
+			results[i].Err = err
+			continue
+		}
+		keys = append(keys, lockKeys(req)...)
+	}
+
+	unlock := s.locks.Lock(keys...)
+	defer unlock()
+
+	// The chunk's identifiers are all locked up front, so only the cluster
+	// locks of a single request can deadlock, and it is that request's
+	// savepoint that runs again.
+	err := s.store.WithTx(func(store ContactStore) error {
+		if _, err := store.LockKeys(keys); err != nil {
+			return err
+		}
+		for i, req := range reqs {
+			if results[i].Err != nil {
+				continue
+			}
+			results[i].Err = retryConflicts(func() error {
+				return store.WithTx(func(store ContactStore) error {
+					var err error
+					results[i].Response, err = s.withStore(store).identify(req)
+					return err
+				})
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		// Nothing in the chunk was committed.
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = BatchResult{Err: err}
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/database/dbtest"
+	"bitespeed-identity-reconciliation/internal/models"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestIdentityService_IdentifyBatch(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, link_precedence, created_at) VALUES
+			(1, 'lorraine@hillvalley.edu', '123456', 'primary', '2023-04-01 00:00:00');
+	`)
+	if _, err := service.EraseIdentity(1); err != nil {
+		t.Fatalf("EraseIdentity() error = %v", err)
+	}
+	dbtest.FailOn(t, db, "INSERT", "contacts", `NEW.email = 'biff@hillvalley.edu'`)
+
+	results := service.IdentifyBatch([]*models.IdentifyRequest{
+		{Email: stringPtr("doc@hillvalley.edu"), PhoneNumber: phonePtr("111")},
+		{},
+		{Email: stringPtr("lorraine@hillvalley.edu")},
+		{Email: stringPtr("biff@hillvalley.edu"), PhoneNumber: phonePtr("222")},
+		{Email: stringPtr("marty@hillvalley.edu"), PhoneNumber: phonePtr("222")},
+		// Joins the first and the previous request's identities.
+		{Email: stringPtr("doc@hillvalley.edu"), PhoneNumber: phonePtr("222")},
+	})
+
+	if len(results) != 6 {
+		t.Fatalf("Expected 6 results, got %d", len(results))
+	}
+	if results[1].Err == nil {
+		t.Error("Expected an error for the empty request")
+	}
+	if !errors.Is(results[2].Err, ErrIdentityErased) {
+		t.Errorf("Expected ErrIdentityErased, got %v", results[2].Err)
+	}
+	if results[3].Err == nil {
+		t.Error("Expected the injected failure for the third request")
+	}
+	for _, i := range []int{0, 4, 5} {
+		if results[i].Err != nil {
+			t.Fatalf("Request %d: unexpected error %v", i, results[i].Err)
+		}
+	}
+
+	merged := results[5].Response.Contact
+	if merged.PrimaryContactID != results[0].Response.Contact.PrimaryContactID {
+		t.Errorf("Expected the oldest primary %d to win, got %d",
+			results[0].Response.Contact.PrimaryContactID, merged.PrimaryContactID)
+	}
+	if want := []string{"doc@hillvalley.edu", "marty@hillvalley.edu"}; !reflect.DeepEqual(merged.Emails, want) {
+		t.Errorf("Expected emails %v, got %v", want, merged.Emails)
+	}
+
+	// The failed request left nothing behind; the others were committed.
+	var biff, total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts WHERE email = 'biff@hillvalley.edu'`).Scan(&biff); err != nil {
+		t.Fatalf("Failed to count contacts: %v", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts`).Scan(&total); err != nil {
+		t.Fatalf("Failed to count contacts: %v", err)
+	}
+	if biff != 0 || total != 2 {
+		t.Errorf("Expected 2 contacts and none for biff, got %d and %d", total, biff)
+	}
+}
+
+func TestIdentityService_IdentifyBatchAcrossChunks(t *testing.T) {
+	service, _ := newTestService(t)
+
+	// Every request shares a phone number with the first, so each chunk
+	// builds on the contacts committed by the previous ones.
+	reqs := make([]*models.IdentifyRequest, 2*BatchChunkSize+1)
+	for i := range reqs {
+		reqs[i] = &models.IdentifyRequest{
+			Email:       stringPtr(fmt.Sprintf("customer%d@example.com", i)),
+			PhoneNumber: phonePtr("555"),
+		}
+	}
+
+	results := service.IdentifyBatch(reqs)
+	for i, result := range results {
+		if result.Err != nil {
+			t.Fatalf("Request %d: unexpected error %v", i, result.Err)
+		}
+		contact := result.Response.Contact
+		if len(contact.Emails) != i+1 || contact.Emails[i] != *reqs[i].Email {
+			t.Fatalf("Request %d: expected %d emails ending in %s, got %v", i, i+1, *reqs[i].Email, contact.Emails)
+		}
+		if contact.PrimaryContactID != results[0].Response.Contact.PrimaryContactID {
+			t.Fatalf("Request %d: expected primary %d, got %d", i, results[0].Response.Contact.PrimaryContactID, contact.PrimaryContactID)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrIdentifiersBlocked is returned when every identifier in a request
+	// is blocklisted, leaving nothing to reconcile on.
+	ErrIdentifiersBlocked = newError(utils.KindValidation, "identifiers_blocked", "every identifier in the request is blocklisted")
+	// ErrInvalidBlockedIdentifier is returned when a blocklist entry has an
+	// unknown type or a value that cannot be normalized.
+	ErrInvalidBlockedIdentifier = newError(utils.KindValidation, "invalid_blocklist_entry", "invalid blocklist entry")
+	// ErrAlreadyBlocked is returned when an identifier is already listed.
+	ErrAlreadyBlocked = newError(utils.KindConflict, "already_blocked", "identifier is already blocklisted")
+	// ErrBlocklistEntryNotFound is returned when a blocklist ID does not
+	// exist.
+	ErrBlocklistEntryNotFound = newError(utils.KindNotFound, "blocklist_entry_not_found", "blocklist entry not found")
+)
+
+// blocklist holds the normalized identifiers that never link contacts.
+// A nil blocklist blocks nothing.
+type blocklist struct {
+	emails map[string]bool
+	phones map[string]bool
+}
+
+func (b *blocklist) blocksEmail(email *string) bool {
+	return b != nil && email != nil && b.emails[*email]
+}
+
+func (b *blocklist) blocksPhone(phoneNumber *string) bool {
+	return b != nil && phoneNumber != nil && b.phones[*phoneNumber]
+}
+
+// loadBlocklist reads the blocklist. It is read on every reconciliation so
+// that changes made through the admin API apply at once.
+func (s *IdentityService) loadBlocklist() (*blocklist, error) {
+	entries, err := s.store.ListBlockedIdentifiers()
+	if err != nil {
+		return nil, fmt.Errorf("error loading blocklist: %w", err)
+	}
+
+	b := &blocklist{
+		emails: make(map[string]bool),
+		phones: make(map[string]bool),
+	}
+	for _, entry := range entries {
+		switch entry.Type {
+		case models.IdentifierEmail:
+			b.emails[entry.Value] = true
+		case models.IdentifierPhone:
+			b.phones[entry.Value] = true
+		}
+	}
+	return b, nil
+}
+
+// BlockIdentifier adds an email or phone number to the blocklist. The value
+// is normalized the same way as request identifiers, so any spelling of a
+// listed identifier is blocked.
+func (s *IdentityService) BlockIdentifier(entry *models.BlockedIdentifier) (*models.BlockedIdentifier, error) {
+	value := strings.TrimSpace(entry.Value)
+	if value == "" {
+		return nil, invalid(ErrInvalidBlockedIdentifier, fieldError("value", "value is required"))
+	}
+
+	var normalized string
+	var err error
+	switch entry.Type {
+	case models.IdentifierEmail:
+		normalized, err = s.normalizer.NormalizeEmail(value)
+	case models.IdentifierPhone:
+		normalized, err = s.normalizer.NormalizePhone(value)
+	default:
+		return nil, invalid(ErrInvalidBlockedIdentifier, fieldError("type",
+			fmt.Sprintf("type must be %q or %q", models.IdentifierEmail, models.IdentifierPhone)))
+	}
+	if err != nil {
+		return nil, invalid(ErrInvalidBlockedIdentifier, fieldError("value", err.Error()))
+	}
+
+	blocked := &models.BlockedIdentifier{
+		Type:   entry.Type,
+		Value:  normalized,
+		Reason: entry.Reason,
+	}
+	created, err := s.store.CreateBlockedIdentifier(blocked)
+	if err != nil {
+		return nil, fmt.Errorf("error saving blocklist entry: %w", err)
+	}
+	if !created {
+		return nil, ErrAlreadyBlocked
+	}
+
+	return blocked, nil
+}
+
+// ListBlockedIdentifiers returns the blocklist.
+func (s *IdentityService) ListBlockedIdentifiers() ([]models.BlockedIdentifier, error) {
+	entries, err := s.store.ListBlockedIdentifiers()
+	if err != nil {
+		return nil, fmt.Errorf("error loading blocklist: %w", err)
+	}
+	return entries, nil
+}
+
+// UnblockIdentifier removes a blocklist entry. Contacts kept apart while the
+// identifier was listed are merged by the next request that links them.
+func (s *IdentityService) UnblockIdentifier(id int) error {
+	deleted, err := s.store.DeleteBlockedIdentifier(id)
+	if err != nil {
+		return fmt.Errorf("error deleting blocklist entry: %w", err)
+	}
+	if !deleted {
+		return ErrBlocklistEntryNotFound
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"errors"
+	"testing"
+)
+
+func TestIdentityService_BlocklistedIdentifiersDoNotLink(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at) VALUES
+			(1, 'lorraine@hillvalley.edu', '0000000000', NULL, 'primary', '2023-04-01 00:00:00'),
+			(2, 'biff@hillvalley.edu', '717171', NULL, 'primary', '2023-04-02 00:00:00');
+	`)
+
+	for _, entry := range []models.BlockedIdentifier{
+		{Type: models.IdentifierPhone, Value: "000-000-0000"},
+		{Type: models.IdentifierEmail, Value: " NoReply@FluxKart.com"},
+	} {
+		if _, err := service.BlockIdentifier(&entry); err != nil {
+			t.Fatalf("BlockIdentifier() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		request     *models.IdentifyRequest
+		wantPrimary int
+		wantErr     error
+	}{
+		{
+			name:        "Blocklisted phone does not link a new email",
+			request:     &models.IdentifyRequest{Email: stringPtr("marty@hillvalley.edu"), PhoneNumber: phonePtr("0000000000")},
+			wantPrimary: 3,
+		},
+		{
+			name:        "Blocklisted phone does not merge two identities",
+			request:     &models.IdentifyRequest{Email: stringPtr("biff@hillvalley.edu"), PhoneNumber: phonePtr("0000000000")},
+			wantPrimary: 2,
+		},
+		{
+			name:        "Blocklisted email does not link",
+			request:     &models.IdentifyRequest{Email: stringPtr("noreply@fluxkart.com"), PhoneNumber: phonePtr("717171")},
+			wantPrimary: 2,
+		},
+		{
+			name:    "Only blocklisted identifiers",
+			request: &models.IdentifyRequest{Email: stringPtr("noreply@fluxkart.com"), PhoneNumber: phonePtr("0000000000")},
+			wantErr: ErrIdentifiersBlocked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := service.IdentifyContact(tt.request)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IdentifyContact() error = %v", err)
+			}
+			if response.Contact.PrimaryContactID != tt.wantPrimary {
+				t.Errorf("Expected primary %d, got %d", tt.wantPrimary, response.Contact.PrimaryContactID)
+			}
+		})
+	}
+
+	var primaries int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts WHERE link_precedence = 'primary'`).Scan(&primaries); err != nil {
+		t.Fatalf("Failed to count primaries: %v", err)
+	}
+	if primaries != 3 {
+		t.Errorf("Expected 3 separate identities, got %d", primaries)
+	}
+}
+
+func TestIdentityService_BlockIdentifier(t *testing.T) {
+	service, _ := newTestService(t)
+
+	entry, err := service.BlockIdentifier(&models.BlockedIdentifier{Type: models.IdentifierEmail, Value: "Orders@FluxKart.com"})
+	if err != nil {
+		t.Fatalf("BlockIdentifier() error = %v", err)
+	}
+	if entry.ID == 0 || entry.Value != "orders@fluxkart.com" {
+		t.Errorf("Expected a stored, normalized entry, got %+v", entry)
+	}
+
+	tests := []struct {
+		name    string
+		entry   models.BlockedIdentifier
+		wantErr error
+	}{
+		{"Duplicate after normalization", models.BlockedIdentifier{Type: models.IdentifierEmail, Value: "orders@fluxkart.com "}, ErrAlreadyBlocked},
+		{"Unknown type", models.BlockedIdentifier{Type: "address", Value: "1640 Riverside Drive"}, ErrInvalidBlockedIdentifier},
+		{"Empty value", models.BlockedIdentifier{Type: models.IdentifierPhone, Value: "  "}, ErrInvalidBlockedIdentifier},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.BlockIdentifier(&tt.entry); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := service.UnblockIdentifier(entry.ID); err != nil {
+		t.Fatalf("UnblockIdentifier() error = %v", err)
+	}
+	if err := service.UnblockIdentifier(entry.ID); !errors.Is(err, ErrBlocklistEntryNotFound) {
+		t.Errorf("Expected ErrBlocklistEntryNotFound, got %v", err)
+	}
+
+	entries, err := service.ListBlockedIdentifiers()
+	if err != nil {
+		t.Fatalf("ListBlockedIdentifiers() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected an empty blocklist, got %+v", entries)
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"context"
+	"sync"
+)
+
+// ErrShuttingDown is returned for writes started after Drain.
+var ErrShuttingDown = newError(utils.KindUnavailable, "shutting_down", "service is shutting down")
+
+// txGate is a ContactStore that keeps count of its open transactions, so
+// that shutdown can wait for them before the database is closed.
+type txGate struct {
+	ContactStore
+
+	mu     sync.Mutex
+	active int
+	closed bool
+	// idle is closed once the gate is closed and no transaction is open.
+	idle chan struct{}
+}
+
+func newTxGate(store ContactStore) *txGate {
+	return &txGate{ContactStore: store, idle: make(chan struct{})}
+}
+
+func (g *txGate) WithTx(fn func(store ContactStore) error) error {
+	return g.withTx(g.ContactStore, fn)
+}
+
+func (g *txGate) WithContext(ctx context.Context) ContactStore {
+	return gatedStore{ContactStore: g.ContactStore.WithContext(ctx), gate: g}
+}
+
+// withTx runs a transaction of store, counting it as one of the gate's.
+func (g *txGate) withTx(store ContactStore, fn func(store ContactStore) error) error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return ErrShuttingDown
+	}
+	g.active++
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		g.active--
+		if g.closed && g.active == 0 {
+			close(g.idle)
+		}
+		g.mu.Unlock()
+	}()
+
+	return store.WithTx(fn)
+}
+
+func (g *txGate) drain(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.closed {
+		g.closed = true
+		if g.active == 0 {
+			close(g.idle)
+		}
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-g.idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// gatedStore is the store of a gate bound to a context. Its transactions
+// are counted by the gate like those of the gate itself.
+type gatedStore struct {
+	ContactStore
+	gate *txGate
+}
+
+func (s gatedStore) WithTx(fn func(store ContactStore) error) error {
+	return s.gate.withTx(s.ContactStore, fn)
+}
+
+func (s gatedStore) WithContext(ctx context.Context) ContactStore {
+	return s.gate.WithContext(ctx)
+}
+
+// Drain refuses new writes, which fail with ErrShuttingDown from then on,
+// and waits until every open transaction has committed or rolled back, or
+// until ctx is done. Once it returns nil the store can be closed.
+func (s *IdentityService) Drain(ctx context.Context) error {
+	return s.gate.drain(ctx)
+}
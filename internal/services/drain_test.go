@@ -0,0 +1,51 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdentityService_Drain(t *testing.T) {
+	service, db := newTestService(t)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	txErr := make(chan error, 1)
+	go func() {
+		txErr <- service.store.WithTx(func(store ContactStore) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	drained := make(chan error, 1)
+	go func() { drained <- service.Drain(context.Background()) }()
+
+	// The open transaction holds up the drain, and no new one may start.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := service.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Drain to wait for the open transaction, got %v", err)
+	}
+	if _, err := service.IdentifyContact(&models.IdentifyRequest{Email: stringPtr("doc@hillvalley.edu")}); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected ErrShuttingDown, got %v", err)
+	}
+
+	close(release)
+	if err := <-txErr; err != nil {
+		t.Errorf("Expected the open transaction to commit, got %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("Expected Drain to succeed, got %v", err)
+	}
+	if err := service.Drain(context.Background()); err != nil {
+		t.Errorf("Expected a second Drain to succeed, got %v", err)
+	}
+	if count := countContacts(t, db); count != 0 {
+		t.Errorf("Expected no contacts, got %d", count)
+	}
+}
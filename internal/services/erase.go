@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrIdentityErased is returned when a request carries an identifier that
+// belonged to an erased identity, so stale events cannot recreate it.
+var ErrIdentityErased = newError(utils.KindConflict, "identity_erased", "identifier belongs to an erased identity")
+
+// MinErasureKeyLength is the shortest erasure key accepted. Without a long
+// secret key, tombstones could be reversed by hashing guessed emails and
+// phone numbers.
+const MinErasureKeyLength = 32
+
+// ErrErasureDisabled is returned by EraseIdentity when the service has no
+// erasure key of at least MinErasureKeyLength bytes.
+var ErrErasureDisabled = newError(utils.KindUnavailable, "erasure_disabled",
+	fmt.Sprintf("identity erasure needs an erasure key of at least %d bytes", MinErasureKeyLength))
+
+// EraseIdentity permanently removes every contact that belongs or belonged
+// to the identity of primaryID and tombstones the hashes of their
+// normalized identifiers. Everything happens in one transaction.
+func (s *IdentityService) EraseIdentity(primaryID int) (*models.ErasureReceipt, error) {
+	if len(s.erasureKey) < MinErasureKeyLength {
+		return nil, ErrErasureDisabled
+	}
+
+	var receipt *models.ErasureReceipt
+	err := s.store.WithTx(func(store ContactStore) error {
+		if err := store.LockAll(); err != nil {
+			return err
+		}
+		var err error
+		receipt, err = s.withStore(store).eraseIdentity(primaryID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+func (s *IdentityService) eraseIdentity(primaryID int) (*models.ErasureReceipt, error) {
+	primary, err := s.store.FindByID(primaryID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading contact: %w", err)
+	}
+	if primary == nil || primary.LinkPrecedence != "primary" {
+		return nil, ErrContactNotFound
+	}
+
+	contacts, err := s.erasureSet(primaryID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	hashes := []string{}
+	contactIDs := []int{}
+	for _, contact := range contacts {
+		contactIDs = append(contactIDs, contact.ID)
+		for _, hash := range s.identifierHashes(contact.NormalizedEmail, contact.NormalizedPhoneNumber) {
+			if !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	sort.Strings(hashes)
+
+	receiptID, err := newReceiptID()
+	if err != nil {
+		return nil, err
+	}
+	erasedAt := time.Now().UTC()
+
+	if _, err := s.store.DeleteContacts(contactIDs); err != nil {
+		return nil, fmt.Errorf("error erasing contacts: %w", err)
+	}
+	if err := s.store.CreateTombstones(hashes, receiptID, erasedAt); err != nil {
+		return nil, fmt.Errorf("error recording tombstones: %w", err)
+	}
+
+	return &models.ErasureReceipt{
+		ReceiptID:        receiptID,
+		PrimaryContactID: primaryID,
+		ErasedContactIDs: contactIDs,
+		IdentifierHashes: hashes,
+		ErasedAt:         erasedAt,
+	}, nil
+}
+
+// erasureSet returns every contact that belongs or ever belonged to the
+// identity of primaryID, ordered by ID: its live cluster, and the
+// soft-deleted contacts its members were ever linked with, directly or
+// through other such contacts, such as a deleted primary whose secondaries
+// were promoted. Live contacts outside the cluster are left alone, as they
+// were split or reverted off into an identity of their own.
+func (s *IdentityService) erasureSet(primaryID int) ([]models.Contact, error) {
+	contacts, err := s.getAllContactsInGroup(primaryID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	for _, contact := range contacts {
+		seen[contact.ID] = true
+	}
+	for i := 0; i < len(contacts); i++ {
+		related, err := s.store.FindEverLinked(contacts[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading link history: %w", err)
+		}
+		for _, contact := range related {
+			if seen[contact.ID] || contact.DeletedAt == nil {
+				continue
+			}
+			seen[contact.ID] = true
+			contacts = append(contacts, contact)
+		}
+	}
+
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].ID < contacts[j].ID })
+	return contacts, nil
+}
+
+// checkTombstones fails with ErrIdentityErased when the request carries an
+// erased identifier.
+func (s *IdentityService) checkTombstones(req *models.IdentifyRequest) error {
+	erased, err := s.store.HasTombstone(s.identifierHashes(req.NormalizedEmail, req.NormalizedPhoneNumber))
+	if err != nil {
+		return fmt.Errorf("error checking erased identifiers: %w", err)
+	}
+	if erased {
+		return ErrIdentityErased
+	}
+	return nil
+}
+
+// identifierHashes returns the keyed hashes of the given normalized
+// identifiers. The key keeps tombstones from being reversed by hashing
+// guessed addresses.
+func (s *IdentityService) identifierHashes(email, phoneNumber *string) []string {
+	var hashes []string
+	if email != nil && *email != "" {
+		hashes = append(hashes, s.hashIdentifier("email:"+*email))
+	}
+	if phoneNumber != nil && *phoneNumber != "" {
+		hashes = append(hashes, s.hashIdentifier("phone:"+*phoneNumber))
+	}
+	return hashes
+}
+
+func (s *IdentityService) hashIdentifier(value string) string {
+	mac := hmac.New(sha256.New, s.erasureKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newReceiptID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating receipt ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
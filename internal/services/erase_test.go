@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"bitespeed-identity-reconciliation/internal/database/dbtest"
+	"bitespeed-identity-reconciliation/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIdentityService_EraseIdentity(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at, deleted_at) VALUES
+			(1, 'lorraine@hillvalley.edu', '123456', NULL, 'primary', '2023-04-01 00:00:00', NULL),
+			(2, 'mcfly@hillvalley.edu', '123456', 1, 'secondary', '2023-04-20 05:30:00', NULL),
+			(3, 'old@hillvalley.edu', '123456', 1, 'secondary', '2023-04-20 06:30:00', '2023-05-01 00:00:00'),
+			(4, 'biff@hillvalley.edu', '717171', NULL, 'primary', '2023-04-21 00:00:00', NULL);
+	`)
+
+	receipt, err := service.EraseIdentity(1)
+	if err != nil {
+		t.Fatalf("EraseIdentity() error = %v", err)
+	}
+
+	if receipt.ReceiptID == "" {
+		t.Error("Expected a receipt ID")
+	}
+	if !reflect.DeepEqual(receipt.ErasedContactIDs, []int{1, 2, 3}) {
+		t.Errorf("Expected erased contacts [1 2 3], got %v", receipt.ErasedContactIDs)
+	}
+	// Three emails, the soft-deleted contact's included, and one phone number.
+	if len(receipt.IdentifierHashes) != 4 {
+		t.Errorf("Expected 4 identifier hashes, got %v", receipt.IdentifierHashes)
+	}
+
+	var remaining int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts WHERE email LIKE '%hillvalley.edu' AND id != 4`).Scan(&remaining); err != nil {
+		t.Fatalf("Failed to count contacts: %v", err)
+	}
+	if remaining != 0 {
+		t.Errorf("Expected every row of the cluster to be removed, %d remain", remaining)
+	}
+
+	requests := []*models.IdentifyRequest{
+		{Email: stringPtr("MCFLY@hillvalley.edu")},
+		{PhoneNumber: phonePtr("123456")},
+		{Email: stringPtr("biff@hillvalley.edu"), PhoneNumber: phonePtr("123456")},
+	}
+	for _, req := range requests {
+		if _, err := service.IdentifyContact(req); !errors.Is(err, ErrIdentityErased) {
+			t.Errorf("Expected ErrIdentityErased, got %v", err)
+		}
+	}
+
+	// Unrelated identities are untouched.
+	response, err := service.IdentifyContact(&models.IdentifyRequest{Email: stringPtr("biff@hillvalley.edu")})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+	if response.Contact.PrimaryContactID != 4 {
+		t.Errorf("Expected primary 4, got %d", response.Contact.PrimaryContactID)
+	}
+}
+
+func TestIdentityService_EraseIdentityFormerMembers(t *testing.T) {
+	service, db := newTestService(t)
+
+	for _, req := range []*models.IdentifyRequest{
+		{Email: stringPtr("doc@hillvalley.edu"), PhoneNumber: phonePtr("111")},
+		{Email: stringPtr("marty@hillvalley.edu"), PhoneNumber: phonePtr("111")},
+		{Email: stringPtr("emmett@hillvalley.edu"), PhoneNumber: phonePtr("333")},
+	} {
+		if _, err := service.IdentifyContact(req); err != nil {
+			t.Fatalf("IdentifyContact() error = %v", err)
+		}
+	}
+	if _, err := service.MergeIdentities([]int{1, 3}, "jane@support"); err != nil {
+		t.Fatalf("MergeIdentities() error = %v", err)
+	}
+	// Deleting the primary promotes contact 2, and splitting gives contact 3
+	// an identity of its own again.
+	if err := service.DeleteContact(1); err != nil {
+		t.Fatalf("DeleteContact() error = %v", err)
+	}
+	if _, err := service.SplitIdentity(2, []int{3}); err != nil {
+		t.Fatalf("SplitIdentity() error = %v", err)
+	}
+
+	receipt, err := service.EraseIdentity(2)
+	if err != nil {
+		t.Fatalf("EraseIdentity() error = %v", err)
+	}
+	if !reflect.DeepEqual(receipt.ErasedContactIDs, []int{1, 2}) {
+		t.Errorf("Expected erased contacts [1 2], got %v", receipt.ErasedContactIDs)
+	}
+	if got := countContacts(t, db); got != 1 {
+		t.Errorf("Expected only the split contact to remain, got %d contacts", got)
+	}
+
+	if _, err := service.IdentifyContact(&models.IdentifyRequest{Email: stringPtr("doc@hillvalley.edu")}); !errors.Is(err, ErrIdentityErased) {
+		t.Errorf("Expected the deleted primary's email to be tombstoned, got %v", err)
+	}
+	response, err := service.IdentifyContact(&models.IdentifyRequest{Email: stringPtr("emmett@hillvalley.edu")})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+	if response.Contact.PrimaryContactID != 3 {
+		t.Errorf("Expected the split identity to survive, got %+v", response.Contact)
+	}
+}
+
+func TestIdentityService_EraseIdentityRequiresPrimary(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, linked_id, link_precedence) VALUES
+			(1, 'lorraine@hillvalley.edu', NULL, 'primary'),
+			(2, 'mcfly@hillvalley.edu', 1, 'secondary');
+	`)
+
+	for _, id := range []int{2, 99} {
+		if _, err := service.EraseIdentity(id); !errors.Is(err, ErrContactNotFound) {
+			t.Errorf("EraseIdentity(%d): expected ErrContactNotFound, got %v", id, err)
+		}
+	}
+	if got := countContacts(t, db); got != 2 {
+		t.Errorf("Expected nothing to be erased, got %d contacts", got)
+	}
+}
+
+func TestIdentityService_EraseIdentityRollsBack(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, link_precedence) VALUES (1, 'lorraine@hillvalley.edu', 'primary');
+	`)
+	dbtest.FailOn(t, db, "INSERT", "identity_tombstones", "")
+
+	if _, err := service.EraseIdentity(1); err == nil {
+		t.Fatal("Expected error from injected failure but got none")
+	}
+	if got := countContacts(t, db); got != 1 {
+		t.Errorf("Expected the erase to be rolled back, got %d contacts", got)
+	}
+}
+
+func TestIdentityService_EraseIdentityWithoutKey(t *testing.T) {
+	_, db := newTestService(t)
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, link_precedence, created_at) VALUES
+			(1, 'lorraine@hillvalley.edu', '123456', 'primary', '2023-04-01 00:00:00');
+	`)
+
+	for _, key := range [][]byte{nil, []byte("too short")} {
+		service := NewIdentityService(NewSQLStore(database.NewContactRepository(db)), nil, key)
+		if _, err := service.EraseIdentity(1); !errors.Is(err, ErrErasureDisabled) {
+			t.Errorf("Expected ErrErasureDisabled for key %q, got %v", key, err)
+		}
+	}
+	if count := countContacts(t, db); count != 1 {
+		t.Errorf("Expected the contact to be kept, got %d contacts", count)
+	}
+}
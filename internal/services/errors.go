@@ -0,0 +1,52 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"strings"
+)
+
+// Error is an error the service returns on purpose, as opposed to a failure
+// of the store. Each has a Kind, which decides its status code, and a stable
+// code clients can match on. Errors compare equal under errors.Is when
+// their codes match, so an Error with details still matches its sentinel.
+type Error struct {
+	kind    utils.Kind
+	code    string
+	message string
+	fields  []utils.FieldError
+}
+
+func newError(kind utils.Kind, code, message string) *Error {
+	return &Error{kind: kind, code: code, message: message}
+}
+
+func (e *Error) Error() string                   { return e.message }
+func (e *Error) Kind() utils.Kind                { return e.kind }
+func (e *Error) Code() string                    { return e.code }
+func (e *Error) FieldErrors() []utils.FieldError { return e.fields }
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.code == e.code
+}
+
+// invalid returns sentinel with the problems in fields, all of which are
+// named in its message.
+func invalid(sentinel *Error, fields ...utils.FieldError) *Error {
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field.Message
+	}
+	return withFields(sentinel, sentinel.message+": "+strings.Join(messages, "; "), fields...)
+}
+
+// withFields returns sentinel with its message replaced and the problems in
+// fields attached.
+func withFields(sentinel *Error, message string, fields ...utils.FieldError) *Error {
+	return &Error{kind: sentinel.kind, code: sentinel.code, message: message, fields: fields}
+}
+
+// fieldError is shorthand for a utils.FieldError.
+func fieldError(field, message string) utils.FieldError {
+	return utils.FieldError{Field: field, Message: message}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIdentityService_GetContactHistory(t *testing.T) {
+	service, _ := newTestService(t)
+
+	requests := []*models.IdentifyRequest{
+		{Email: stringPtr("lorraine@hillvalley.edu"), PhoneNumber: phonePtr("123456")},
+		{Email: stringPtr("mcfly@hillvalley.edu"), PhoneNumber: phonePtr("717171")},
+		// Merges the two identities, demoting contact 2.
+		{Email: stringPtr("lorraine@hillvalley.edu"), PhoneNumber: phonePtr("717171")},
+	}
+	for _, req := range requests {
+		if _, err := service.IdentifyContact(req); err != nil {
+			t.Fatalf("IdentifyContact() error = %v", err)
+		}
+	}
+	if _, err := service.SplitIdentity(1, []int{2}); err != nil {
+		t.Fatalf("SplitIdentity() error = %v", err)
+	}
+	if err := service.DeleteContact(2); err != nil {
+		t.Fatalf("DeleteContact() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		contactID int
+		want      []string
+		wantErr   error
+	}{
+		{
+			name:      "Untouched primary",
+			contactID: 1,
+			want:      []string{models.EventCreated},
+		},
+		{
+			name:      "Merged, split and deleted contact",
+			contactID: 2,
+			want:      []string{models.EventCreated, models.EventDemoted, models.EventSplit, models.EventDeleted},
+		},
+		{
+			name:      "Unknown contact",
+			contactID: 99,
+			wantErr:   ErrContactNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history, err := service.GetContactHistory(tt.contactID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetContactHistory() error = %v", err)
+			}
+
+			var got []string
+			for _, event := range history.Events {
+				got = append(got, event.Type)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected events %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,270 +1,549 @@
 package services
 
 import (
-	"bitespeed-identity-reconciliation/internal/database"
 	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/normalize"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"context"
+	"errors"
 	"fmt"
 	"sort"
 )
 
+var (
+	// ErrContactNotFound is returned when a contact ID does not exist or has
+	// been deleted.
+	ErrContactNotFound = newError(utils.KindNotFound, "contact_not_found", "contact not found")
+	// ErrInvalidRequest is returned when an identify request has no usable
+	// email or phone number.
+	ErrInvalidRequest = newError(utils.KindValidation, "invalid_request", "invalid request")
+)
+
 type IdentityService struct {
-    contactRepo *database.ContactRepository
+	store      ContactStore
+	gate       *txGate
+	normalizer *normalize.Normalizer
+	locks      *keyLocker
+	// erasureKey keys the hashes of erased identifiers.
+	erasureKey []byte
+}
+
+// NewIdentityService returns a service that keeps contacts in store and
+// matches identifiers after normalizing them with normalizer.
+func NewIdentityService(store ContactStore, normalizer *normalize.Normalizer, erasureKey []byte) *IdentityService {
+	gate := newTxGate(store)
+	return &IdentityService{
+		store:      gate,
+		gate:       gate,
+		normalizer: normalizer,
+		locks:      newKeyLocker(),
+		erasureKey: erasureKey,
+	}
 }
 
-func NewIdentityService() *IdentityService {
-    return &IdentityService{
-        contactRepo: database.ContactRepo,
-    }
+// WithContext returns a copy of the service whose reads and writes run
+// under ctx, typically that of the HTTP request being served. Once ctx is
+// done its queries fail and an open transaction is rolled back, so a
+// request that timed out leaves nothing behind.
+func (s *IdentityService) WithContext(ctx context.Context) *IdentityService {
+	return s.withStore(s.store.WithContext(ctx))
 }
 
+// IdentifyContact reconciles the request against the stored contacts. The
+// request's identifiers are normalized first and all matching is done on the
+// normalized values, while the raw values are stored alongside them. The
+// lookup and every write it triggers run in a single transaction, so a
+// failure part-way through a merge leaves the existing clusters untouched.
+//
+// Concurrent requests sharing an email or phone number are serialized by a
+// per-identifier lock, held in the process and in the store, so two first
+// sightings of the same identifier cannot both create a primary. Requests
+// that meet only through a merge are serialized by the store's lock on
+// every cluster they touch.
 func (s *IdentityService) IdentifyContact(req *models.IdentifyRequest) (*models.IdentifyResponse, error) {
 
-    if (req.Email == nil || *req.Email == "") && (req.PhoneNumber == nil || *req.PhoneNumber == "") {
-        return nil, fmt.Errorf("at least one of email or phoneNumber must be provided")
-    }
+	if err := s.prepareRequest(req); err != nil {
+		return nil, err
+	}
+
+	unlock := s.locks.Lock(lockKeys(req)...)
+	defer unlock()
+
+	var response *models.IdentifyResponse
+	err := retryConflicts(func() error {
+		return s.store.WithTx(func(store ContactStore) error {
+			if _, err := store.LockKeys(lockKeys(req)); err != nil {
+				return err
+			}
+			var err error
+			response, err = s.withStore(store).identify(req)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// lockKeys returns the identifiers a request reconciles on.
+func lockKeys(req *models.IdentifyRequest) []string {
+	var keys []string
+	if req.NormalizedEmail != nil {
+		keys = append(keys, "email:"+*req.NormalizedEmail)
+	}
+	if req.NormalizedPhoneNumber != nil {
+		keys = append(keys, "phone:"+*req.NormalizedPhoneNumber)
+	}
+	return keys
+}
 
-    existingContacts, err := s.contactRepo.FindByEmailOrPhone(req.Email, req.PhoneNumber)
-    if err != nil {
-        return nil, fmt.Errorf("error finding existing contacts: %w", err)
-    }
+// withStore returns a copy of the service that uses store for all reads and
+// writes, typically a transaction-scoped store.
+func (s *IdentityService) withStore(store ContactStore) *IdentityService {
+	scoped := *s
+	scoped.store = store
+	return &scoped
+}
 
-    if len(existingContacts) == 0 {
-        return s.createNewPrimaryContact(req)
-    }
+func (s *IdentityService) identify(req *models.IdentifyRequest) (*models.IdentifyResponse, error) {
+	if err := s.checkTombstones(req); err != nil {
+		return nil, err
+	}
+
+	plan, err := s.planIdentify(req)
+	if err != nil {
+		return nil, err
+	}
+	if plan, err = s.lockClusters(req, plan); err != nil {
+		return nil, err
+	}
+
+	if err := s.applyPlan(plan); err != nil {
+		return nil, err
+	}
+	if plan.mergedInto != 0 {
+		if _, err := s.recordMerge(plan, models.MergeTriggeredByIdentify); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.buildResponse(plan.contacts), nil
+}
 
-    contactGroups := s.groupContactsByPrimary(existingContacts)
+// lockClusters takes the store's lock on every cluster plan touches. A
+// cluster may have changed while its lock was awaited, so the request is
+// planned again after each new lock until the plan touches no cluster that
+// is not locked. It returns the final plan.
+func (s *IdentityService) lockClusters(req *models.IdentifyRequest, plan *identifyPlan) (*identifyPlan, error) {
+	locked := make(map[int]bool)
+	for {
+		var keys []string
+		for _, primaryID := range plan.clusters {
+			if !locked[primaryID] {
+				locked[primaryID] = true
+				keys = append(keys, fmt.Sprintf("cluster:%d", primaryID))
+			}
+		}
+		if len(keys) == 0 {
+			return plan, nil
+		}
+
+		tookLocks, err := s.store.LockKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+		if !tookLocks {
+			return plan, nil
+		}
+		if plan, err = s.planIdentify(req); err != nil {
+			return nil, err
+		}
+	}
+}
 
-    if len(contactGroups) > 1 {
-        return s.mergeContactGroups(contactGroups, req)
-    }
+// LookupContact runs the same matching as IdentifyContact but writes
+// nothing. It returns the identity the request would resolve to together
+// with the writes IdentifyContact would make. Contacts that would be created
+// have no ID yet and are left out of the returned IDs.
+func (s *IdentityService) LookupContact(req *models.IdentifyRequest) (*models.LookupResponse, error) {
+	if err := s.prepareRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkTombstones(req); err != nil {
+		return nil, err
+	}
+
+	plan, err := s.planIdentify(req)
+	if err != nil {
+		return nil, err
+	}
+
+	response := s.buildResponse(plan.contacts)
+	if response == nil {
+		return nil, fmt.Errorf("no primary contact found")
+	}
+
+	writes := plan.writes
+	if writes == nil {
+		writes = []models.ContactWrite{}
+	}
+
+	return &models.LookupResponse{
+		Contact: response.Contact,
+		Writes:  writes,
+	}, nil
+}
 
-    primaryID := s.getPrimaryContactID(contactGroups)
-    allContacts := s.getAllContactsInGroup(primaryID)
-    
-    if s.contactExistsWithExactMatch(allContacts, req) {
-        return s.buildResponse(allContacts), nil
-    }
+// prepareRequest normalizes the request's identifiers and checks that at
+// least one of them is usable.
+func (s *IdentityService) prepareRequest(req *models.IdentifyRequest) error {
+	if err := s.normalizer.Apply(req); err != nil {
+		var fieldErr *normalize.FieldError
+		if errors.As(err, &fieldErr) {
+			return invalid(ErrInvalidRequest, fieldError(fieldErr.Field, fieldErr.Error()))
+		}
+		return err
+	}
+
+	if req.NormalizedEmail == nil && req.NormalizedPhoneNumber == nil {
+		return withFields(ErrInvalidRequest, "at least one of email or phoneNumber must be provided",
+			fieldError("email", "required when phoneNumber is missing"),
+			fieldError("phoneNumber", "required when email is missing"))
+	}
+
+	return nil
+}
 
-    return s.createSecondaryContact(primaryID, allContacts, req)
+// GetContact resolves any contact ID, primary or secondary, to the identity
+// it belongs to without modifying anything.
+func (s *IdentityService) GetContact(id int) (*models.ContactDetailsResponse, error) {
+	contact, err := s.store.FindByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading contact: %w", err)
+	}
+	if contact == nil {
+		return nil, ErrContactNotFound
+	}
+
+	primaryID := contact.ID
+	if contact.LinkedID != nil {
+		primaryID = *contact.LinkedID
+	}
+
+	contacts, err := s.getAllContactsInGroup(primaryID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := s.buildResponse(contacts)
+	if response == nil {
+		return nil, ErrContactNotFound
+	}
+
+	return &models.ContactDetailsResponse{
+		Contact:  response.Contact,
+		Contacts: contacts,
+	}, nil
 }
 
-func (s *IdentityService) createNewPrimaryContact(req *models.IdentifyRequest) (*models.IdentifyResponse, error) {
-    contact := &models.Contact{
-        PhoneNumber:    req.PhoneNumber,
-        Email:          req.Email,
-        LinkedID:       nil,
-        LinkPrecedence: "primary",
-    }
-
-    if err := s.contactRepo.Create(contact); err != nil {
-        return nil, fmt.Errorf("error creating new primary contact: %w", err)
-    }
-
-    return &models.IdentifyResponse{
-        Contact: models.ContactInfo{
-            PrimaryContactID:     contact.ID,
-            Emails:              s.getEmailsFromContact(contact),
-            PhoneNumbers:        s.getPhoneNumbersFromContact(contact),
-            SecondaryContactIDs: []int{},
-        },
-    }, nil
+// GetContactHistory returns the recorded link changes of a contact, oldest
+// first. The history outlives the contact: deleted and erased contacts keep
+// theirs. Contacts stored before history was recorded have none.
+func (s *IdentityService) GetContactHistory(id int) (*models.ContactHistoryResponse, error) {
+	events, err := s.store.FindEventsByContactID(id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading contact history: %w", err)
+	}
+
+	if len(events) == 0 {
+		contact, err := s.store.FindByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("error loading contact: %w", err)
+		}
+		if contact == nil {
+			return nil, ErrContactNotFound
+		}
+	}
+
+	return &models.ContactHistoryResponse{
+		ContactID: id,
+		Events:    events,
+	}, nil
 }
 
 func (s *IdentityService) groupContactsByPrimary(contacts []models.Contact) map[int][]models.Contact {
-    groups := make(map[int][]models.Contact)
-    
-    for _, contact := range contacts {
-        primaryID := contact.ID
-        if contact.LinkedID != nil {
-            primaryID = *contact.LinkedID
-        }
-        groups[primaryID] = append(groups[primaryID], contact)
-    }
-    
-    return groups
+	groups := make(map[int][]models.Contact)
+
+	for _, contact := range contacts {
+		primaryID := contact.ID
+		if contact.LinkedID != nil {
+			primaryID = *contact.LinkedID
+		}
+		groups[primaryID] = append(groups[primaryID], contact)
+	}
+
+	return groups
 }
 
-func (s *IdentityService) mergeContactGroups(contactGroups map[int][]models.Contact, req *models.IdentifyRequest) (*models.IdentifyResponse, error) {
-
-    var oldestPrimary *models.Contact
-    var allContacts []models.Contact
-    
-    for primaryID, contacts := range contactGroups {
-        for _, contact := range contacts {
-            allContacts = append(allContacts, contact)
-            if contact.ID == primaryID && (oldestPrimary == nil || contact.CreatedAt.Before(oldestPrimary.CreatedAt)) {
-                oldestPrimary = &contact
-            }
-        }
-    }
-
-    if oldestPrimary == nil {
-        return nil, fmt.Errorf("no primary contact found")
-    }
-
-    for _, contact := range allContacts {
-        if contact.LinkPrecedence == "primary" && contact.ID != oldestPrimary.ID {
-            err := s.contactRepo.UpdateLinkPrecedence(contact.ID, oldestPrimary.ID, "secondary")
-            if err != nil {
-                return nil, fmt.Errorf("error updating contact precedence: %w", err)
-            }
-        }
-    }
-
-    mergedContacts := s.getAllContactsInGroup(oldestPrimary.ID)
-    
-    if !s.contactExistsWithExactMatch(mergedContacts, req) {
-        return s.createSecondaryContact(oldestPrimary.ID, mergedContacts, req)
-    }
-
-    return s.buildResponse(mergedContacts), nil
+// mergeContactGroups plans the merge of several clusters into one: the
+// oldest primary wins, and every other contact, including the secondaries
+// of demoted primaries, is linked directly to it. If none of the clusters
+// has a live primary, the oldest contact is promoted. It returns the
+// winning primary's ID. Once applied, the plan is recorded as a merge that
+// can be reverted.
+func (s *IdentityService) mergeContactGroups(plan *identifyPlan, contactGroups map[int][]models.Contact) (int, error) {
+
+	var oldestPrimary *models.Contact
+	for i := range plan.contacts {
+		contact := &plan.contacts[i]
+		if _, ok := contactGroups[contact.ID]; !ok || contact.LinkPrecedence != "primary" {
+			continue
+		}
+		if oldestPrimary == nil || contact.CreatedAt.Before(oldestPrimary.CreatedAt) ||
+			(contact.CreatedAt.Equal(oldestPrimary.CreatedAt) && contact.ID < oldestPrimary.ID) {
+			oldestPrimary = contact
+		}
+	}
+
+	if oldestPrimary == nil {
+		oldest := oldestContactIndex(plan.contacts)
+		if oldest < 0 {
+			return 0, fmt.Errorf("no primary contact found")
+		}
+		plan.promote(oldest)
+		oldestPrimary = &plan.contacts[oldest]
+	}
+	primaryID := oldestPrimary.ID
+
+	for i, contact := range plan.contacts {
+		if contact.ID == primaryID {
+			continue
+		}
+		if contact.LinkPrecedence == "secondary" && contact.LinkedID != nil && *contact.LinkedID == primaryID {
+			continue
+		}
+		plan.link(i, primaryID)
+	}
+
+	plan.mergedInto = primaryID
+	return primaryID, nil
 }
 
-func (s *IdentityService) getAllContactsInGroup(primaryID int) []models.Contact {
-    var allContacts []models.Contact
-    
-    primary, err := s.contactRepo.FindByID(primaryID)
-    if err == nil && primary != nil {
-        allContacts = append(allContacts, *primary)
-    }
-    
-    secondaries, err := s.contactRepo.FindByLinkedID(primaryID)
-    if err == nil {
-        allContacts = append(allContacts, secondaries...)
-    }
-    
-    return allContacts
+// DeleteContact soft-deletes a contact. When the contact is a primary, its
+// oldest surviving secondary is promoted and the remaining secondaries are
+// re-linked to it, so the cluster keeps exactly one primary.
+func (s *IdentityService) DeleteContact(id int) error {
+	return s.store.WithTx(func(store ContactStore) error {
+		if err := store.LockAll(); err != nil {
+			return err
+		}
+		return s.withStore(store).deleteContact(id)
+	})
 }
 
-func (s *IdentityService) contactExistsWithExactMatch(contacts []models.Contact, req *models.IdentifyRequest) bool {
-    for _, contact := range contacts {
-        emailMatch := (req.Email == nil && contact.Email == nil) || 
-                     (req.Email != nil && contact.Email != nil && *req.Email == *contact.Email)
-        phoneMatch := (req.PhoneNumber == nil && contact.PhoneNumber == nil) || 
-                     (req.PhoneNumber != nil && contact.PhoneNumber != nil && *req.PhoneNumber == *contact.PhoneNumber)
-        
-        if emailMatch && phoneMatch {
-            return true
-        }
-    }
-    return false
+func (s *IdentityService) deleteContact(id int) error {
+	contact, err := s.store.FindByID(id)
+	if err != nil {
+		return fmt.Errorf("error loading contact: %w", err)
+	}
+	if contact == nil {
+		return ErrContactNotFound
+	}
+
+	if err := s.store.SoftDelete(id); err != nil {
+		return fmt.Errorf("error deleting contact: %w", err)
+	}
+
+	if contact.LinkPrecedence != "primary" {
+		return nil
+	}
+
+	secondaries, err := s.store.FindByLinkedID(id)
+	if err != nil {
+		return fmt.Errorf("error loading secondary contacts: %w", err)
+	}
+
+	if _, err := s.relinkToOldest(secondaries); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// relinkToOldest makes the oldest of contacts the primary and links every
+// other contact directly to it, skipping contacts already in place. It
+// returns the primary's ID, or 0 when contacts is empty.
+func (s *IdentityService) relinkToOldest(contacts []models.Contact) (int, error) {
+	oldest := oldestContactIndex(contacts)
+	if oldest < 0 {
+		return 0, nil
+	}
+	primaryID := contacts[oldest].ID
+
+	if contacts[oldest].LinkPrecedence != "primary" || contacts[oldest].LinkedID != nil {
+		if err := s.store.UpdateLinkPrecedence(primaryID, nil, "primary"); err != nil {
+			return 0, fmt.Errorf("error promoting contact: %w", err)
+		}
+	}
+	for _, contact := range contacts {
+		if contact.ID == primaryID {
+			continue
+		}
+		if contact.LinkPrecedence == "secondary" && contact.LinkedID != nil && *contact.LinkedID == primaryID {
+			continue
+		}
+		if err := s.store.UpdateLinkPrecedence(contact.ID, &primaryID, "secondary"); err != nil {
+			return 0, fmt.Errorf("error relinking contact: %w", err)
+		}
+	}
+
+	return primaryID, nil
+}
+
+// oldestContactIndex returns the index of the oldest contact, breaking ties
+// on ID, or -1 when contacts is empty.
+func oldestContactIndex(contacts []models.Contact) int {
+	oldest := -1
+	for i, contact := range contacts {
+		if oldest < 0 || contact.CreatedAt.Before(contacts[oldest].CreatedAt) ||
+			(contact.CreatedAt.Equal(contacts[oldest].CreatedAt) && contact.ID < contacts[oldest].ID) {
+			oldest = i
+		}
+	}
+	return oldest
 }
 
-func (s *IdentityService) createSecondaryContact(primaryID int, existingContacts []models.Contact, req *models.IdentifyRequest) (*models.IdentifyResponse, error) {
+func (s *IdentityService) getAllContactsInGroup(primaryID int) ([]models.Contact, error) {
+	var allContacts []models.Contact
 
-    if s.hasNewInformation(existingContacts, req) {
-        secondaryContact := &models.Contact{
-            PhoneNumber:    req.PhoneNumber,
-            Email:          req.Email,
-            LinkedID:       &primaryID,
-            LinkPrecedence: "secondary",
-        }
+	primary, err := s.store.FindByID(primaryID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading primary contact: %w", err)
+	}
+	if primary != nil {
+		allContacts = append(allContacts, *primary)
+	}
 
-        if err := s.contactRepo.Create(secondaryContact); err != nil {
-            return nil, fmt.Errorf("error creating secondary contact: %w", err)
-        }
+	secondaries, err := s.store.FindByLinkedID(primaryID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading secondary contacts: %w", err)
+	}
+	allContacts = append(allContacts, secondaries...)
 
-        existingContacts = append(existingContacts, *secondaryContact)
-    }
+	return allContacts, nil
+}
 
-    return s.buildResponse(existingContacts), nil
+func (s *IdentityService) contactExistsWithExactMatch(contacts []models.Contact, req *models.IdentifyRequest) bool {
+	for _, contact := range contacts {
+		emailMatch := (req.NormalizedEmail == nil && contact.NormalizedEmail == nil) ||
+			(req.NormalizedEmail != nil && contact.NormalizedEmail != nil && *req.NormalizedEmail == *contact.NormalizedEmail)
+		phoneMatch := (req.NormalizedPhoneNumber == nil && contact.NormalizedPhoneNumber == nil) ||
+			(req.NormalizedPhoneNumber != nil && contact.NormalizedPhoneNumber != nil && *req.NormalizedPhoneNumber == *contact.NormalizedPhoneNumber)
+
+		if emailMatch && phoneMatch {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *IdentityService) hasNewInformation(contacts []models.Contact, req *models.IdentifyRequest) bool {
-    emails := make(map[string]bool)
-    phones := make(map[string]bool)
-    
-    for _, contact := range contacts {
-        if contact.Email != nil {
-            emails[*contact.Email] = true
-        }
-        if contact.PhoneNumber != nil {
-            phones[*contact.PhoneNumber] = true
-        }
-    }
-    
-    hasNewEmail := req.Email != nil && !emails[*req.Email]
-    hasNewPhone := req.PhoneNumber != nil && !phones[*req.PhoneNumber]
-    
-    return hasNewEmail || hasNewPhone
+	emails := make(map[string]bool)
+	phones := make(map[string]bool)
+
+	for _, contact := range contacts {
+		if contact.NormalizedEmail != nil {
+			emails[*contact.NormalizedEmail] = true
+		}
+		if contact.NormalizedPhoneNumber != nil {
+			phones[*contact.NormalizedPhoneNumber] = true
+		}
+	}
+
+	hasNewEmail := req.NormalizedEmail != nil && !emails[*req.NormalizedEmail]
+	hasNewPhone := req.NormalizedPhoneNumber != nil && !phones[*req.NormalizedPhoneNumber]
+
+	return hasNewEmail || hasNewPhone
 }
 
 func (s *IdentityService) getPrimaryContactID(contactGroups map[int][]models.Contact) int {
-    for primaryID := range contactGroups {
-        return primaryID
-    }
-    return 0
+	for primaryID := range contactGroups {
+		return primaryID
+	}
+	return 0
 }
 
 func (s *IdentityService) buildResponse(contacts []models.Contact) *models.IdentifyResponse {
 
-    var primary *models.Contact
-    var secondaries []models.Contact
-    
-    for _, contact := range contacts {
-        if contact.LinkPrecedence == "primary" {
-            primary = &contact
-        } else {
-            secondaries = append(secondaries, contact)
-        }
-    }
-    
-    if primary == nil {
-        return nil
-    }
-    
-    emailMap := make(map[string]bool)
-    phoneMap := make(map[string]bool)
-    var emails []string
-    var phoneNumbers []string
-    var secondaryIDs []int
-    
-    if primary.Email != nil && *primary.Email != "" {
-        emails = append(emails, *primary.Email)
-        emailMap[*primary.Email] = true
-    }
-    if primary.PhoneNumber != nil && *primary.PhoneNumber != "" {
-        phoneNumbers = append(phoneNumbers, *primary.PhoneNumber)
-        phoneMap[*primary.PhoneNumber] = true
-    }
-    
-    sort.Slice(secondaries, func(i, j int) bool {
-        return secondaries[i].CreatedAt.Before(secondaries[j].CreatedAt)
-    })
-    
-    for _, contact := range secondaries {
-        secondaryIDs = append(secondaryIDs, contact.ID)
-        
-        if contact.Email != nil && *contact.Email != "" && !emailMap[*contact.Email] {
-            emails = append(emails, *contact.Email)
-            emailMap[*contact.Email] = true
-        }
-        if contact.PhoneNumber != nil && *contact.PhoneNumber != "" && !phoneMap[*contact.PhoneNumber] {
-            phoneNumbers = append(phoneNumbers, *contact.PhoneNumber)
-            phoneMap[*contact.PhoneNumber] = true
-        }
-    }
-    
-    return &models.IdentifyResponse{
-        Contact: models.ContactInfo{
-            PrimaryContactID:     primary.ID,
-            Emails:              emails,
-            PhoneNumbers:        phoneNumbers,
-            SecondaryContactIDs: secondaryIDs,
-        },
-    }
+	var primary *models.Contact
+	var secondaries []models.Contact
+
+	for _, contact := range contacts {
+		if contact.LinkPrecedence == "primary" {
+			primary = &contact
+		} else {
+			secondaries = append(secondaries, contact)
+		}
+	}
+
+	if primary == nil {
+		return nil
+	}
+
+	// Identifiers are listed as the customer sent them, once per
+	// normalized value, the earliest spelling first.
+	emails := newIdentifierList()
+	phoneNumbers := newIdentifierList()
+	secondaryIDs := []int{}
+
+	emails.add(primary.Email, primary.NormalizedEmail)
+	phoneNumbers.add((*string)(primary.PhoneNumber), primary.NormalizedPhoneNumber)
+
+	sort.Slice(secondaries, func(i, j int) bool {
+		return secondaries[i].CreatedAt.Before(secondaries[j].CreatedAt)
+	})
+
+	for _, contact := range secondaries {
+		// Contacts planned by a lookup have no ID yet.
+		if contact.ID != 0 {
+			secondaryIDs = append(secondaryIDs, contact.ID)
+		}
+
+		emails.add(contact.Email, contact.NormalizedEmail)
+		phoneNumbers.add((*string)(contact.PhoneNumber), contact.NormalizedPhoneNumber)
+	}
+
+	return &models.IdentifyResponse{
+		Contact: models.ContactInfo{
+			PrimaryContactID:    primary.ID,
+			Emails:              emails.values,
+			PhoneNumbers:        phoneNumbers.values,
+			SecondaryContactIDs: secondaryIDs,
+		},
+	}
 }
 
-func (s *IdentityService) getEmailsFromContact(contact *models.Contact) []string {
-    if contact.Email != nil && *contact.Email != "" {
-        return []string{*contact.Email}
-    }
-    return []string{}
+// identifierList collects identifiers as they were sent, skipping any whose
+// normalized value is already listed.
+type identifierList struct {
+	values []string
+	seen   map[string]bool
 }
 
-func (s *IdentityService) getPhoneNumbersFromContact(contact *models.Contact) []string {
-    if contact.PhoneNumber != nil && *contact.PhoneNumber != "" {
-        return []string{*contact.PhoneNumber}
-    }
-    return []string{}
-}
\ No newline at end of file
+func newIdentifierList() *identifierList {
+	return &identifierList{values: []string{}, seen: make(map[string]bool)}
+}
+
+func (l *identifierList) add(raw, normalized *string) {
+	if normalized == nil || *normalized == "" || l.seen[*normalized] {
+		return
+	}
+	l.seen[*normalized] = true
+	if raw == nil {
+		raw = normalized
+	}
+	l.values = append(l.values, *raw)
+}
@@ -2,41 +2,22 @@ package services
 
 import (
 	"bitespeed-identity-reconciliation/internal/database"
+	"bitespeed-identity-reconciliation/internal/database/dbtest"
 	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/normalize"
 	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func TestIdentityService_ValidateRequest(t *testing.T) {
-	// Set up test database
-	testDB, err := sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		t.Fatalf("Failed to create test database: %v", err)
-	}
-	defer testDB.Close()
-
-	// Create tables
-	createTablesQuery := `
-	CREATE TABLE contacts (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        phone_number TEXT,
-        email TEXT,
-        linked_id INTEGER,
-        link_precedence TEXT NOT NULL CHECK(link_precedence IN ('primary', 'secondary')),
-        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-        deleted_at DATETIME,
-        FOREIGN KEY (linked_id) REFERENCES contacts(id)
-    );`
-	if _, err := testDB.Exec(createTablesQuery); err != nil {
-		t.Fatalf("Failed to create test tables: %v", err)
-	}
-
-	// Create service with test repository
-	testRepo := database.NewContactRepository(testDB)
-	service := &IdentityService{contactRepo: testRepo}
+	service, _ := newTestService(t)
 
 	tests := []struct {
 		name        string
@@ -47,7 +28,7 @@ func TestIdentityService_ValidateRequest(t *testing.T) {
 			name: "Valid request with both email and phone",
 			request: &models.IdentifyRequest{
 				Email:       stringPtr("test@example.com"),
-				PhoneNumber: stringPtr("1234567890"),
+				PhoneNumber: phonePtr("1234567890"),
 			},
 			expectError: false,
 		},
@@ -63,7 +44,7 @@ func TestIdentityService_ValidateRequest(t *testing.T) {
 			name: "Valid request with only phone",
 			request: &models.IdentifyRequest{
 				Email:       nil,
-				PhoneNumber: stringPtr("1234567890"),
+				PhoneNumber: phonePtr("1234567890"),
 			},
 			expectError: false,
 		},
@@ -71,7 +52,7 @@ func TestIdentityService_ValidateRequest(t *testing.T) {
 			name: "Invalid request with empty values",
 			request: &models.IdentifyRequest{
 				Email:       stringPtr(""),
-				PhoneNumber: stringPtr(""),
+				PhoneNumber: phonePtr(""),
 			},
 			expectError: true,
 		},
@@ -99,6 +80,537 @@ func TestIdentityService_ValidateRequest(t *testing.T) {
 	}
 }
 
+func TestIdentityService_IdentifyContactCommits(t *testing.T) {
+	service, db := newTestService(t)
+
+	first, err := service.IdentifyContact(&models.IdentifyRequest{
+		Email:       stringPtr("lorraine@hillvalley.edu"),
+		PhoneNumber: phonePtr("123456"),
+	})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+
+	second, err := service.IdentifyContact(&models.IdentifyRequest{
+		Email:       stringPtr("mcfly@hillvalley.edu"),
+		PhoneNumber: phonePtr("123456"),
+	})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+
+	if second.Contact.PrimaryContactID != first.Contact.PrimaryContactID {
+		t.Errorf("Expected primary %d, got %d", first.Contact.PrimaryContactID, second.Contact.PrimaryContactID)
+	}
+	if got := countContacts(t, db); got != 2 {
+		t.Errorf("Expected 2 contacts after commit, got %d", got)
+	}
+}
+
+func TestIdentityService_MatchesNormalizedIdentifiers(t *testing.T) {
+	service, db := newTestService(t)
+	normalizer, err := normalize.New(normalize.Config{FoldGmail: true, DefaultCountry: "US"})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	service.normalizer = normalizer
+
+	first, err := service.IdentifyContact(&models.IdentifyRequest{
+		Email:       stringPtr("Doc@HillValley.edu "),
+		PhoneNumber: phonePtr("+1 (555) 010-0000"),
+	})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+
+	requests := []*models.IdentifyRequest{
+		{Email: stringPtr("doc@hillvalley.edu")},
+		{PhoneNumber: phonePtr("5550100000")},
+		{Email: stringPtr("doc@hillvalley.edu"), PhoneNumber: phonePtr("555.010.0000")},
+	}
+	for _, req := range requests {
+		response, err := service.IdentifyContact(req)
+		if err != nil {
+			t.Fatalf("IdentifyContact() error = %v", err)
+		}
+		if response.Contact.PrimaryContactID != first.Contact.PrimaryContactID {
+			t.Errorf("Expected primary %d, got %d", first.Contact.PrimaryContactID, response.Contact.PrimaryContactID)
+		}
+		// The response lists identifiers as they were first sent.
+		if !reflect.DeepEqual(response.Contact.Emails, []string{"Doc@HillValley.edu "}) {
+			t.Errorf("Expected the stored email, got %q", response.Contact.Emails)
+		}
+		if !reflect.DeepEqual(response.Contact.PhoneNumbers, []string{"+1 (555) 010-0000"}) {
+			t.Errorf("Expected the stored phone number, got %q", response.Contact.PhoneNumbers)
+		}
+	}
+
+	if got := countContacts(t, db); got != 1 {
+		t.Errorf("Expected a single contact for differently formatted identifiers, got %d", got)
+	}
+
+	var email, normalizedEmail, phone, normalizedPhone string
+	err = db.QueryRow(`SELECT email, email_normalized, phone_number, phone_normalized FROM contacts`).
+		Scan(&email, &normalizedEmail, &phone, &normalizedPhone)
+	if err != nil {
+		t.Fatalf("Failed to read contact: %v", err)
+	}
+	if email != "Doc@HillValley.edu " || normalizedEmail != "doc@hillvalley.edu" {
+		t.Errorf("Expected raw and normalized email to be stored, got %q and %q", email, normalizedEmail)
+	}
+	if phone != "+1 (555) 010-0000" || normalizedPhone != "+15550100000" {
+		t.Errorf("Expected raw and normalized phone to be stored, got %q and %q", phone, normalizedPhone)
+	}
+}
+
+func TestIdentityService_MergeRelinksDemotedCluster(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at) VALUES
+			(1, 'george@hillvalley.edu', '919191', NULL, 'primary', '2023-04-11 00:00:00'),
+			(2, 'biffsucks@hillvalley.edu', '717171', NULL, 'primary', '2023-04-21 05:30:00'),
+			(3, 'biff@hillvalley.edu', '717171', 2, 'secondary', '2023-04-22 05:30:00');
+	`)
+
+	// Matches the older cluster by email and the newer one only through its
+	// secondary's phone number.
+	response, err := service.IdentifyContact(&models.IdentifyRequest{
+		Email:       stringPtr("george@hillvalley.edu"),
+		PhoneNumber: phonePtr("717171"),
+	})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+
+	if response.Contact.PrimaryContactID != 1 {
+		t.Errorf("Expected primary 1, got %d", response.Contact.PrimaryContactID)
+	}
+	if len(response.Contact.SecondaryContactIDs) != 2 {
+		t.Errorf("Expected secondaries [2 3], got %v", response.Contact.SecondaryContactIDs)
+	}
+	if len(response.Contact.Emails) != 3 {
+		t.Errorf("Expected 3 emails, got %v", response.Contact.Emails)
+	}
+
+	rows, err := db.Query(`SELECT id, linked_id FROM contacts WHERE id IN (2, 3)`)
+	if err != nil {
+		t.Fatalf("Failed to query contacts: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, linkedID int
+		if err := rows.Scan(&id, &linkedID); err != nil {
+			t.Fatalf("Failed to scan contact: %v", err)
+		}
+		if linkedID != 1 {
+			t.Errorf("Contact %d: expected linked_id 1, got %d", id, linkedID)
+		}
+	}
+}
+
+func TestIdentityService_LookupContactWritesNothing(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at) VALUES
+			(1, 'george@hillvalley.edu', '919191', NULL, 'primary', '2023-04-11 00:00:00'),
+			(2, 'biffsucks@hillvalley.edu', '717171', NULL, 'primary', '2023-04-21 05:30:00'),
+			(3, 'biff@hillvalley.edu', '717171', 2, 'secondary', '2023-04-22 05:30:00');
+	`)
+
+	req := func() *models.IdentifyRequest {
+		return &models.IdentifyRequest{
+			Email:       stringPtr("george@hillvalley.edu"),
+			PhoneNumber: phonePtr("717171"),
+		}
+	}
+
+	lookup, err := service.LookupContact(req())
+	if err != nil {
+		t.Fatalf("LookupContact() error = %v", err)
+	}
+
+	wantWrites := []models.ContactWrite{
+		{Operation: models.WriteUpdate, ContactID: 2, LinkedID: intPtr(1), LinkPrecedence: "secondary"},
+		{Operation: models.WriteUpdate, ContactID: 3, LinkedID: intPtr(1), LinkPrecedence: "secondary"},
+	}
+	if !reflect.DeepEqual(lookup.Writes, wantWrites) {
+		t.Errorf("Expected writes %+v, got %+v", wantWrites, lookup.Writes)
+	}
+
+	var secondariesOfOne int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts WHERE linked_id = 1`).Scan(&secondariesOfOne); err != nil {
+		t.Fatalf("Failed to count secondaries: %v", err)
+	}
+	if secondariesOfOne != 0 {
+		t.Errorf("Expected lookup to leave contacts untouched, %d were relinked", secondariesOfOne)
+	}
+
+	identified, err := service.IdentifyContact(req())
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+	if !reflect.DeepEqual(lookup.Contact, identified.Contact) {
+		t.Errorf("Expected lookup %+v to match identify %+v", lookup.Contact, identified.Contact)
+	}
+}
+
+func TestIdentityService_LookupContactNewIdentity(t *testing.T) {
+	service, db := newTestService(t)
+
+	lookup, err := service.LookupContact(&models.IdentifyRequest{Email: stringPtr("doc@hillvalley.edu")})
+	if err != nil {
+		t.Fatalf("LookupContact() error = %v", err)
+	}
+
+	if lookup.Contact.PrimaryContactID != 0 {
+		t.Errorf("Expected no primary ID for an unknown identity, got %d", lookup.Contact.PrimaryContactID)
+	}
+	if len(lookup.Writes) != 1 || lookup.Writes[0].Operation != models.WriteCreate || lookup.Writes[0].LinkPrecedence != "primary" {
+		t.Errorf("Expected a single primary create, got %+v", lookup.Writes)
+	}
+	if got := countContacts(t, db); got != 0 {
+		t.Errorf("Expected lookup to create nothing, got %d contacts", got)
+	}
+}
+
+func TestIdentityService_DeleteContact(t *testing.T) {
+	seed := `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at) VALUES
+			(1, 'lorraine@hillvalley.edu', '123456', NULL, 'primary', '2023-04-01 00:00:00'),
+			(2, 'mcfly@hillvalley.edu', '123456', 1, 'secondary', '2023-04-20 05:30:00'),
+			(3, 'marty@hillvalley.edu', '123456', 1, 'secondary', '2023-04-21 05:30:00');
+	`
+
+	tests := []struct {
+		name            string
+		deleteID        int
+		expectError     error
+		lookupID        int
+		wantPrimary     int
+		wantSecondaries []int
+	}{
+		{
+			name:            "Deleting a primary promotes the oldest secondary",
+			deleteID:        1,
+			lookupID:        3,
+			wantPrimary:     2,
+			wantSecondaries: []int{3},
+		},
+		{
+			name:            "Deleting a secondary keeps the primary",
+			deleteID:        2,
+			lookupID:        3,
+			wantPrimary:     1,
+			wantSecondaries: []int{3},
+		},
+		{
+			name:        "Unknown contact",
+			deleteID:    99,
+			expectError: ErrContactNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			execSQL(t, db, seed)
+
+			err := service.DeleteContact(tt.deleteID)
+			if tt.expectError != nil {
+				if !errors.Is(err, tt.expectError) {
+					t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DeleteContact() error = %v", err)
+			}
+
+			if _, err := service.GetContact(tt.deleteID); !errors.Is(err, ErrContactNotFound) {
+				t.Errorf("Expected deleted contact to be gone, got %v", err)
+			}
+
+			details, err := service.GetContact(tt.lookupID)
+			if err != nil {
+				t.Fatalf("GetContact() error = %v", err)
+			}
+			if details.Contact.PrimaryContactID != tt.wantPrimary {
+				t.Errorf("Expected primary %d, got %d", tt.wantPrimary, details.Contact.PrimaryContactID)
+			}
+			if !reflect.DeepEqual(details.Contact.SecondaryContactIDs, tt.wantSecondaries) {
+				t.Errorf("Expected secondaries %v, got %v", tt.wantSecondaries, details.Contact.SecondaryContactIDs)
+			}
+
+			response, err := service.IdentifyContact(&models.IdentifyRequest{PhoneNumber: phonePtr("123456")})
+			if err != nil {
+				t.Fatalf("IdentifyContact() error = %v", err)
+			}
+			if response.Contact.PrimaryContactID != tt.wantPrimary {
+				t.Errorf("Expected identify to return primary %d, got %d", tt.wantPrimary, response.Contact.PrimaryContactID)
+			}
+		})
+	}
+}
+
+func TestIdentityService_PromotesOrphanedSecondaries(t *testing.T) {
+	service, db := newTestService(t)
+
+	// Left behind by deleting a primary by hand.
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at, deleted_at) VALUES
+			(1, 'lorraine@hillvalley.edu', '123456', NULL, 'primary', '2023-04-01 00:00:00', '2023-05-01 00:00:00'),
+			(2, 'mcfly@hillvalley.edu', '123456', 1, 'secondary', '2023-04-20 05:30:00', NULL),
+			(3, 'marty@hillvalley.edu', '123456', 1, 'secondary', '2023-04-21 05:30:00', NULL);
+	`)
+
+	response, err := service.IdentifyContact(&models.IdentifyRequest{Email: stringPtr("marty@hillvalley.edu")})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+	if response == nil || response.Contact.PrimaryContactID != 2 {
+		t.Fatalf("Expected contact 2 to be promoted, got %+v", response)
+	}
+	if !reflect.DeepEqual(response.Contact.SecondaryContactIDs, []int{3}) {
+		t.Errorf("Expected secondaries [3], got %v", response.Contact.SecondaryContactIDs)
+	}
+}
+
+func TestIdentityService_RollbackOnFailedMerge(t *testing.T) {
+	service, db := newTestService(t)
+
+	// Legacy data: the same email sits in two unlinked clusters, so a request
+	// that also hits a third cluster by phone has to demote two primaries.
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, link_precedence, created_at) VALUES
+			(1, 'doc@hillvalley.edu', '111', 'primary', '2023-04-01 00:00:00'),
+			(2, 'doc@hillvalley.edu', '222', 'primary', '2023-04-02 00:00:00'),
+			(3, 'marty@hillvalley.edu', '333', 'primary', '2023-04-03 00:00:00');
+	`)
+
+	// Let the first demotion through and fail the second one.
+	dbtest.FailOn(t, db, "UPDATE", "contacts", `NEW.link_precedence = 'secondary'
+		AND (SELECT COUNT(*) FROM contacts WHERE link_precedence = 'secondary') >= 1`)
+
+	_, err := service.IdentifyContact(&models.IdentifyRequest{
+		Email:       stringPtr("doc@hillvalley.edu"),
+		PhoneNumber: phonePtr("333"),
+	})
+	if err == nil {
+		t.Fatal("Expected error from injected failure but got none")
+	}
+
+	var primaries int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts WHERE link_precedence = 'primary' AND linked_id IS NULL`).Scan(&primaries); err != nil {
+		t.Fatalf("Failed to count primaries: %v", err)
+	}
+	if primaries != 3 {
+		t.Errorf("Expected all 3 primaries to survive the rollback, got %d", primaries)
+	}
+}
+
+func TestIdentityService_RollbackOnFailedCreate(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, link_precedence, created_at) VALUES
+			(1, 'doc@hillvalley.edu', '111', 'primary', '2023-04-01 00:00:00'),
+			(2, 'doc@hillvalley.edu', '222', 'primary', '2023-04-02 00:00:00');
+	`)
+	dbtest.FailOn(t, db, "INSERT", "contacts", "")
+
+	// Merges the two clusters sharing the email, then tries to store the new
+	// phone number.
+	_, err := service.IdentifyContact(&models.IdentifyRequest{
+		Email:       stringPtr("doc@hillvalley.edu"),
+		PhoneNumber: phonePtr("999"),
+	})
+	if err == nil {
+		t.Fatal("Expected error from injected failure but got none")
+	}
+
+	var secondaries int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts WHERE link_precedence = 'secondary'`).Scan(&secondaries); err != nil {
+		t.Fatalf("Failed to count secondaries: %v", err)
+	}
+	if secondaries != 0 {
+		t.Errorf("Expected merge to be rolled back, got %d secondaries", secondaries)
+	}
+}
+
+func TestIdentityService_ConcurrentIdentifyCreatesOnePrimary(t *testing.T) {
+	service, _ := newTestService(t)
+
+	const identities = 10
+	const requestsPerIdentity = 30
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, identities*requestsPerIdentity)
+	for i := 0; i < identities; i++ {
+		email := fmt.Sprintf("customer%d@fluxkart.com", i)
+		phone := fmt.Sprintf("55501%05d", i)
+		for j := 0; j < requestsPerIdentity; j++ {
+			req := &models.IdentifyRequest{
+				Email:       stringPtr(email),
+				PhoneNumber: phonePtr(phone),
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if _, err := service.IdentifyContact(req); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("IdentifyContact() error = %v", err)
+	}
+
+	for i := 0; i < identities; i++ {
+		email := fmt.Sprintf("customer%d@fluxkart.com", i)
+		phone := fmt.Sprintf("55501%05d", i)
+
+		// Every request is identical, so a correctly serialized run stores a
+		// single primary row; a lost race leaves a second, demoted row behind.
+		contacts, err := service.store.FindByEmailOrPhone(&email, &phone)
+		if err != nil {
+			t.Fatalf("Failed to find contacts: %v", err)
+		}
+		rows, primaries := len(contacts), 0
+		for _, contact := range contacts {
+			if contact.LinkPrecedence == "primary" {
+				primaries++
+			}
+		}
+		if rows != 1 || primaries != 1 {
+			t.Errorf("Expected exactly 1 primary contact for %s, got %d rows and %d primaries", email, rows, primaries)
+		}
+	}
+}
+
+func TestIdentityService_ConcurrentMergesAcrossInstances(t *testing.T) {
+	service, db := newTestService(t)
+	// A second service on the same database stands in for another server,
+	// so only the store's locks keep the two apart.
+	other := NewIdentityService(NewSQLStore(database.NewContactRepository(db)), service.normalizer, testErasureKey)
+
+	const customers = 5
+	const requestsPerCustomer = 10
+	for i := 0; i < customers; i++ {
+		for _, req := range []*models.IdentifyRequest{
+			{Email: stringPtr(fmt.Sprintf("doc%d@hillvalley.edu", i)), PhoneNumber: phonePtr(fmt.Sprintf("5550%d", i))},
+			{Email: stringPtr(fmt.Sprintf("emmett%d@hillvalley.edu", i)), PhoneNumber: phonePtr(fmt.Sprintf("5551%d", i))},
+		} {
+			if _, err := service.IdentifyContact(req); err != nil {
+				t.Fatalf("IdentifyContact() error = %v", err)
+			}
+		}
+	}
+
+	// Requests joining each customer's two identities race with requests
+	// adding secondaries to one of them, sharing no identifier with them.
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, customers*requestsPerCustomer)
+	for i := 0; i < customers; i++ {
+		for j := 0; j < requestsPerCustomer; j++ {
+			req := &models.IdentifyRequest{
+				Email:       stringPtr(fmt.Sprintf("emmett%d@hillvalley.edu", i)),
+				PhoneNumber: phonePtr(fmt.Sprintf("5552%d%d", i, j)),
+			}
+			target := service
+			if j%2 == 0 {
+				req = &models.IdentifyRequest{
+					Email:       stringPtr(fmt.Sprintf("doc%d@hillvalley.edu", i)),
+					PhoneNumber: phonePtr(fmt.Sprintf("5551%d", i)),
+				}
+				target = other
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if _, err := target.IdentifyContact(req); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("IdentifyContact() error = %v", err)
+	}
+
+	var chained, primaries int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM contacts c JOIN contacts p ON c.linked_id = p.id
+		WHERE p.linked_id IS NOT NULL OR p.link_precedence != 'primary'
+	`).Scan(&chained)
+	if err != nil {
+		t.Fatalf("Failed to count chained contacts: %v", err)
+	}
+	if chained != 0 {
+		t.Errorf("Expected every secondary to link to a primary, got %d linked to a secondary", chained)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts WHERE link_precedence = 'primary'`).Scan(&primaries); err != nil {
+		t.Fatalf("Failed to count primaries: %v", err)
+	}
+	if primaries != customers {
+		t.Errorf("Expected %d primaries, one per customer, got %d", customers, primaries)
+	}
+}
+
+// newTestService returns a service backed by a fresh database. Requests
+// run on separate connections, so concurrent tests really race.
+func newTestService(t *testing.T) (*IdentityService, *sql.DB) {
+	t.Helper()
+
+	testDB := dbtest.Open(t)
+
+	normalizer, err := normalize.New(normalize.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	store := NewSQLStore(database.NewContactRepository(testDB))
+	return NewIdentityService(store, normalizer, testErasureKey), testDB
+}
+
+// testErasureKey is a key long enough to enable identity erasure.
+var testErasureKey = []byte(strings.Repeat("k", MinErasureKeyLength))
+
+func execSQL(t *testing.T, db *sql.DB, query string) {
+	t.Helper()
+	dbtest.Exec(t, db, query)
+}
+
+func countContacts(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts`).Scan(&count); err != nil {
+		t.Fatalf("Failed to count contacts: %v", err)
+	}
+	return count
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
+
+func phonePtr(s string) *models.PhoneNumber {
+	p := models.PhoneNumber(s)
+	return &p
+}
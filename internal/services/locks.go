@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"sort"
+	"sync"
+)
+
+// keyLocker hands out mutexes keyed by identifier so that requests touching
+// the same email or phone number are reconciled one at a time, while
+// unrelated requests proceed in parallel.
+type keyLocker struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newKeyLocker() *keyLocker {
+	return &keyLocker{locks: make(map[string]*keyLock)}
+}
+
+// Lock acquires the locks for all keys and returns a function that releases
+// them. Keys are locked in sorted order so overlapping sets cannot deadlock.
+func (l *keyLocker) Lock(keys ...string) (unlock func()) {
+	keys = uniqueSorted(keys)
+
+	held := make([]*keyLock, 0, len(keys))
+	for _, key := range keys {
+		l.mu.Lock()
+		lock, ok := l.locks[key]
+		if !ok {
+			lock = &keyLock{}
+			l.locks[key] = lock
+		}
+		lock.refs++
+		l.mu.Unlock()
+
+		lock.mu.Lock()
+		held = append(held, lock)
+	}
+
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].mu.Unlock()
+
+			l.mu.Lock()
+			held[i].refs--
+			if held[i].refs == 0 {
+				delete(l.locks, keys[i])
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+func uniqueSorted(keys []string) []string {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	unique := sorted[:0]
+	for i, key := range sorted {
+		if i == 0 || key != sorted[i-1] {
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+// maxTxAttempts bounds how often a transaction is run when the store keeps
+// aborting it to break deadlocks with concurrent ones.
+const maxTxAttempts = 3
+
+// retryConflicts runs the transaction fn, and runs it again if the store
+// aborted it to break a deadlock, up to maxTxAttempts times in all. Two
+// requests can deadlock when each locks a cluster the other reaches next.
+func retryConflicts(fn func() error) error {
+	var err error
+	for attempt := 0; attempt < maxTxAttempts; attempt++ {
+		if err = fn(); !database.IsConflict(err) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,634 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a ContactStore that keeps everything in process memory,
+// for tests and for deployments that do not need to keep data across
+// restarts. It is safe for concurrent use. Transactions hold the store
+// lock for their whole duration, like SQLite's BEGIN IMMEDIATE, and every
+// change they make is journaled so a failed transaction can be undone.
+type MemoryStore struct {
+	mu    *sync.Mutex
+	state *memoryState
+	// inTx is set on the store handed to a WithTx callback, which already
+	// holds mu.
+	inTx bool
+	// ctx is the context transactions must still be live under to commit,
+	// or nil.
+	ctx context.Context
+}
+
+// memoryState holds the rows of every table. Contacts are indexed by the
+// email and phone number they match on and by the contact they link to;
+// the indexes include soft-deleted contacts, which lookups filter out.
+type memoryState struct {
+	contacts   map[int]models.Contact
+	byEmail    map[string]map[int]bool
+	byPhone    map[string]map[int]bool
+	byLinkedID map[int]map[int]bool
+
+	// events[i] has ID i+1.
+	events          []models.ContactEvent
+	eventsByContact map[int][]int
+
+	tombstones map[string]bool
+	exclusions map[[2]int]bool
+	blocklist  []models.BlockedIdentifier
+	merges     map[int]models.Merge
+
+	lastContactID int
+	lastBlockID   int
+	lastMergeID   int
+
+	// journal collects the undo steps of the running transaction, or is
+	// nil outside one.
+	journal []func()
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu: &sync.Mutex{},
+		state: &memoryState{
+			contacts:        make(map[int]models.Contact),
+			byEmail:         make(map[string]map[int]bool),
+			byPhone:         make(map[string]map[int]bool),
+			byLinkedID:      make(map[int]map[int]bool),
+			eventsByContact: make(map[int][]int),
+			tombstones:      make(map[string]bool),
+			exclusions:      make(map[[2]int]bool),
+			merges:          make(map[int]models.Merge),
+		},
+	}
+}
+
+func (m *MemoryStore) WithTx(fn func(store ContactStore) error) error {
+	if m.inTx {
+		return m.withSavepoint(fn)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.journal = []func(){}
+	committed := false
+	defer func() {
+		if !committed {
+			for i := len(m.state.journal) - 1; i >= 0; i-- {
+				m.state.journal[i]()
+			}
+		}
+		m.state.journal = nil
+	}()
+
+	if err := fn(&MemoryStore{mu: m.mu, state: m.state, inTx: true, ctx: m.ctx}); err != nil {
+		return err
+	}
+	if m.ctx != nil {
+		if err := m.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	committed = true
+	return nil
+}
+
+// WithContext returns a view of the store whose transactions are undone
+// instead of committed once ctx is done. A transaction-scoped store keeps
+// the context of its transaction.
+func (m *MemoryStore) WithContext(ctx context.Context) ContactStore {
+	if m.inTx {
+		return m
+	}
+	return &MemoryStore{mu: m.mu, state: m.state, ctx: ctx}
+}
+
+// LockKeys takes no locks, since transactions hold the store lock.
+func (m *MemoryStore) LockKeys(keys []string) (bool, error) {
+	return false, nil
+}
+
+// LockAll does nothing, since transactions hold the store lock.
+func (m *MemoryStore) LockAll() error {
+	return nil
+}
+
+// withSavepoint runs fn within the current transaction and undoes its
+// changes, and only those, if it fails.
+func (m *MemoryStore) withSavepoint(fn func(store ContactStore) error) error {
+	mark := len(m.state.journal)
+	released := false
+	defer func() {
+		if !released {
+			for i := len(m.state.journal) - 1; i >= mark; i-- {
+				m.state.journal[i]()
+			}
+			m.state.journal = m.state.journal[:mark]
+		}
+	}()
+
+	if err := fn(m); err != nil {
+		return err
+	}
+	released = true
+	return nil
+}
+
+// lock takes the store lock for a single call outside a transaction and
+// returns the function that releases it.
+func (m *MemoryStore) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// onRollback journals an undo step when a transaction is running.
+func (s *memoryState) onRollback(undo func()) {
+	if s.journal != nil {
+		s.journal = append(s.journal, undo)
+	}
+}
+
+// view returns a contact as the SQL stores return it: normalized values
+// fall back to the raw ones for contacts that have none.
+func view(contact models.Contact) models.Contact {
+	if contact.NormalizedPhoneNumber == nil && contact.PhoneNumber != nil {
+		phoneNumber := string(*contact.PhoneNumber)
+		contact.NormalizedPhoneNumber = &phoneNumber
+	}
+	if contact.NormalizedEmail == nil {
+		contact.NormalizedEmail = contact.Email
+	}
+	return contact
+}
+
+// putContact inserts or replaces a contact and keeps the indexes in step.
+func (s *memoryState) putContact(contact models.Contact) {
+	previous, existed := s.contacts[contact.ID]
+	s.setContact(contact.ID, previous, existed, contact, true)
+	s.onRollback(func() { s.setContact(contact.ID, contact, true, previous, existed) })
+}
+
+// removeContact deletes a contact outright.
+func (s *memoryState) removeContact(id int) {
+	previous, existed := s.contacts[id]
+	if !existed {
+		return
+	}
+	s.setContact(id, previous, true, models.Contact{}, false)
+	s.onRollback(func() { s.setContact(id, models.Contact{}, false, previous, true) })
+}
+
+func (s *memoryState) setContact(id int, old models.Contact, hadOld bool, contact models.Contact, hasNew bool) {
+	if hadOld {
+		s.index(old, false)
+		delete(s.contacts, id)
+	}
+	if hasNew {
+		s.contacts[id] = contact
+		s.index(contact, true)
+	}
+}
+
+func (s *memoryState) index(contact models.Contact, add bool) {
+	contact = view(contact)
+	if contact.NormalizedEmail != nil {
+		updateIndex(s.byEmail, *contact.NormalizedEmail, contact.ID, add)
+	}
+	if contact.NormalizedPhoneNumber != nil {
+		updateIndex(s.byPhone, *contact.NormalizedPhoneNumber, contact.ID, add)
+	}
+	if contact.LinkedID != nil {
+		updateIndex(s.byLinkedID, *contact.LinkedID, contact.ID, add)
+	}
+}
+
+func updateIndex[K comparable](index map[K]map[int]bool, key K, id int, add bool) {
+	if add {
+		if index[key] == nil {
+			index[key] = make(map[int]bool)
+		}
+		index[key][id] = true
+		return
+	}
+	delete(index[key], id)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// liveContacts returns the contacts with the given IDs that are not
+// deleted, oldest first.
+func (s *memoryState) liveContacts(ids ...map[int]bool) []models.Contact {
+	seen := make(map[int]bool)
+	var contacts []models.Contact
+	for _, set := range ids {
+		for id := range set {
+			contact := s.contacts[id]
+			if seen[id] || contact.DeletedAt != nil {
+				continue
+			}
+			seen[id] = true
+			contacts = append(contacts, view(contact))
+		}
+	}
+	sortOldestFirst(contacts)
+	return contacts
+}
+
+func sortOldestFirst(contacts []models.Contact) {
+	sort.Slice(contacts, func(i, j int) bool {
+		if !contacts[i].CreatedAt.Equal(contacts[j].CreatedAt) {
+			return contacts[i].CreatedAt.Before(contacts[j].CreatedAt)
+		}
+		return contacts[i].ID < contacts[j].ID
+	})
+}
+
+func (m *MemoryStore) FindByID(id int) (*models.Contact, error) {
+	defer m.lock()()
+
+	contact, ok := m.state.contacts[id]
+	if !ok || contact.DeletedAt != nil {
+		return nil, nil
+	}
+	contact = view(contact)
+	return &contact, nil
+}
+
+func (m *MemoryStore) FindByEmailOrPhone(email, phoneNumber *string) ([]models.Contact, error) {
+	defer m.lock()()
+
+	var sets []map[int]bool
+	if email != nil {
+		sets = append(sets, m.state.byEmail[*email])
+	}
+	if phoneNumber != nil {
+		sets = append(sets, m.state.byPhone[*phoneNumber])
+	}
+	return m.state.liveContacts(sets...), nil
+}
+
+func (m *MemoryStore) FindByLinkedID(linkedID int) ([]models.Contact, error) {
+	defer m.lock()()
+
+	return m.state.liveContacts(m.state.byLinkedID[linkedID]), nil
+}
+
+func (m *MemoryStore) Create(contact *models.Contact) error {
+	defer m.lock()()
+
+	now := time.Now()
+	lastID := m.state.lastContactID
+	m.state.lastContactID++
+	m.state.onRollback(func() { m.state.lastContactID = lastID })
+
+	contact.ID = m.state.lastContactID
+	contact.CreatedAt = now
+	contact.UpdatedAt = now
+
+	stored := *contact
+	stored.LinkedID = copyInt(contact.LinkedID)
+	stored.DeletedAt = nil
+	m.state.putContact(stored)
+
+	precedence := contact.LinkPrecedence
+	m.state.recordEvent(contact.ID, models.EventCreated, nil, nil, contact.LinkedID, &precedence, now)
+	return nil
+}
+
+func (m *MemoryStore) UpdateLinkPrecedence(id int, linkedID *int, linkPrecedence string) error {
+	defer m.lock()()
+	m.state.updateLink(id, linkedID, linkPrecedence, "")
+	return nil
+}
+
+func (m *MemoryStore) DetachContact(id int, linkedID *int, linkPrecedence string) error {
+	defer m.lock()()
+	m.state.updateLink(id, linkedID, linkPrecedence, models.EventSplit)
+	return nil
+}
+
+func (m *MemoryStore) RestoreLink(id int, linkedID *int, linkPrecedence string) error {
+	defer m.lock()()
+	m.state.updateLink(id, linkedID, linkPrecedence, models.EventReverted)
+	return nil
+}
+
+// updateLink mirrors the SQL stores: missing and deleted contacts are left
+// alone, and an unchanged link is only recorded when eventType is given.
+func (s *memoryState) updateLink(id int, linkedID *int, linkPrecedence string, eventType string) {
+	contact, ok := s.contacts[id]
+	if !ok || contact.DeletedAt != nil {
+		return
+	}
+
+	previousLinkedID, previousPrecedence := contact.LinkedID, contact.LinkPrecedence
+	now := time.Now()
+	contact.LinkedID = copyInt(linkedID)
+	contact.LinkPrecedence = linkPrecedence
+	contact.UpdatedAt = now
+	s.putContact(contact)
+
+	if eventType == "" {
+		if previousPrecedence == linkPrecedence && sameID(previousLinkedID, linkedID) {
+			return
+		}
+		switch {
+		case previousPrecedence == "primary" && linkPrecedence == "secondary":
+			eventType = models.EventDemoted
+		case previousPrecedence == "secondary" && linkPrecedence == "primary":
+			eventType = models.EventPromoted
+		default:
+			eventType = models.EventLinked
+		}
+	}
+	s.recordEvent(id, eventType, previousLinkedID, &previousPrecedence, linkedID, &linkPrecedence, now)
+}
+
+func sameID(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func copyInt(p *int) *int {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func copyString(p *string) *string {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func (m *MemoryStore) SoftDelete(id int) error {
+	defer m.lock()()
+
+	contact, ok := m.state.contacts[id]
+	if !ok || contact.DeletedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	contact.DeletedAt = &now
+	contact.UpdatedAt = now
+	m.state.putContact(contact)
+
+	precedence := contact.LinkPrecedence
+	m.state.recordEvent(id, models.EventDeleted, contact.LinkedID, &precedence, nil, nil, now)
+	return nil
+}
+
+func (m *MemoryStore) DeleteContacts(ids []int) (int, error) {
+	defer m.lock()()
+
+	now := time.Now()
+	removed := 0
+	for _, id := range ids {
+		contact, ok := m.state.contacts[id]
+		if !ok {
+			continue
+		}
+		precedence := contact.LinkPrecedence
+		m.state.recordEvent(id, models.EventErased, contact.LinkedID, &precedence, nil, nil, now)
+		m.state.removeContact(id)
+		removed++
+	}
+	return removed, nil
+}
+
+func (m *MemoryStore) FindEverLinked(id int) ([]models.Contact, error) {
+	defer m.lock()()
+
+	related := make(map[int]bool)
+	for other := range m.state.byLinkedID[id] {
+		related[other] = true
+	}
+	if contact, ok := m.state.contacts[id]; ok && contact.LinkedID != nil {
+		related[*contact.LinkedID] = true
+	}
+	for _, event := range m.state.events {
+		if event.ContactID == id {
+			for _, other := range []*int{event.LinkedID, event.PreviousLinkedID} {
+				if other != nil {
+					related[*other] = true
+				}
+			}
+		}
+		if sameID(event.LinkedID, &id) || sameID(event.PreviousLinkedID, &id) {
+			related[event.ContactID] = true
+		}
+	}
+	delete(related, id)
+
+	var contacts []models.Contact
+	for other := range related {
+		if contact, ok := m.state.contacts[other]; ok {
+			contacts = append(contacts, view(contact))
+		}
+	}
+	sortOldestFirst(contacts)
+	return contacts, nil
+}
+
+// recordEvent appends to the history of a contact.
+func (s *memoryState) recordEvent(contactID int, eventType string, previousLinkedID *int, previousPrecedence *string, linkedID *int, linkPrecedence *string, at time.Time) {
+	s.events = append(s.events, models.ContactEvent{
+		ID:                     len(s.events) + 1,
+		ContactID:              contactID,
+		Type:                   eventType,
+		PreviousLinkedID:       copyInt(previousLinkedID),
+		PreviousLinkPrecedence: copyString(previousPrecedence),
+		LinkedID:               copyInt(linkedID),
+		LinkPrecedence:         copyString(linkPrecedence),
+		CreatedAt:              at,
+	})
+	s.eventsByContact[contactID] = append(s.eventsByContact[contactID], len(s.events)-1)
+
+	s.onRollback(func() {
+		s.events = s.events[:len(s.events)-1]
+		positions := s.eventsByContact[contactID]
+		s.eventsByContact[contactID] = positions[:len(positions)-1]
+	})
+}
+
+func (m *MemoryStore) FindEventsByContactID(contactID int) ([]models.ContactEvent, error) {
+	defer m.lock()()
+
+	events := []models.ContactEvent{}
+	for _, i := range m.state.eventsByContact[contactID] {
+		events = append(events, m.state.events[i])
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) CreateTombstones(hashes []string, receiptID string, erasedAt time.Time) error {
+	defer m.lock()()
+
+	for _, hash := range hashes {
+		if m.state.tombstones[hash] {
+			continue
+		}
+		m.state.tombstones[hash] = true
+		m.state.onRollback(func() { delete(m.state.tombstones, hash) })
+	}
+	return nil
+}
+
+func (m *MemoryStore) HasTombstone(hashes []string) (bool, error) {
+	defer m.lock()()
+
+	for _, hash := range hashes {
+		if m.state.tombstones[hash] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) CreateLinkExclusion(contactID, excludedContactID int) error {
+	defer m.lock()()
+
+	exclusion := [2]int{contactID, excludedContactID}
+	if !m.state.exclusions[exclusion] {
+		m.state.exclusions[exclusion] = true
+		m.state.onRollback(func() { delete(m.state.exclusions, exclusion) })
+	}
+	return nil
+}
+
+func (m *MemoryStore) FindLinkExclusions(contactIDs []int) ([][2]int, error) {
+	defer m.lock()()
+
+	if len(contactIDs) < 2 {
+		return nil, nil
+	}
+
+	ids := slices.Compact(slices.Sorted(slices.Values(contactIDs)))
+	var exclusions [][2]int
+	for _, contactID := range ids {
+		for _, excludedContactID := range ids {
+			exclusion := [2]int{contactID, excludedContactID}
+			if m.state.exclusions[exclusion] {
+				exclusions = append(exclusions, exclusion)
+			}
+		}
+	}
+	return exclusions, nil
+}
+
+func (m *MemoryStore) CreateBlockedIdentifier(entry *models.BlockedIdentifier) (bool, error) {
+	defer m.lock()()
+
+	for _, existing := range m.state.blocklist {
+		if existing.Type == entry.Type && existing.Value == entry.Value {
+			return false, nil
+		}
+	}
+
+	lastID, previous := m.state.lastBlockID, m.state.blocklist
+	m.state.lastBlockID++
+	entry.ID = m.state.lastBlockID
+	entry.CreatedAt = time.Now()
+	m.state.blocklist = append(slices.Clip(m.state.blocklist), *entry)
+	m.state.onRollback(func() { m.state.lastBlockID, m.state.blocklist = lastID, previous })
+	return true, nil
+}
+
+func (m *MemoryStore) ListBlockedIdentifiers() ([]models.BlockedIdentifier, error) {
+	defer m.lock()()
+
+	return append([]models.BlockedIdentifier{}, m.state.blocklist...), nil
+}
+
+func (m *MemoryStore) DeleteBlockedIdentifier(id int) (bool, error) {
+	defer m.lock()()
+
+	for i, entry := range m.state.blocklist {
+		if entry.ID == id {
+			previous := m.state.blocklist
+			m.state.blocklist = slices.Delete(slices.Clone(previous), i, i+1)
+			m.state.onRollback(func() { m.state.blocklist = previous })
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) CreateMerge(merge *models.Merge) error {
+	defer m.lock()()
+
+	lastID := m.state.lastMergeID
+	m.state.lastMergeID++
+	merge.ID = m.state.lastMergeID
+	merge.CreatedAt = time.Now()
+	merge.LastEventID = len(m.state.events)
+
+	stored := *merge
+	stored.Contacts = slices.Clone(merge.Contacts)
+	stored.RevertedAt = nil
+	m.state.merges[stored.ID] = stored
+	m.state.onRollback(func() {
+		delete(m.state.merges, stored.ID)
+		m.state.lastMergeID = lastID
+	})
+	return nil
+}
+
+func (m *MemoryStore) FindMergeByID(id int) (*models.Merge, error) {
+	defer m.lock()()
+
+	merge, ok := m.state.merges[id]
+	if !ok {
+		return nil, nil
+	}
+	merge.Contacts = append([]models.MergeContact{}, merge.Contacts...)
+	return &merge, nil
+}
+
+func (m *MemoryStore) MarkMergeReverted(id int, revertedAt time.Time) error {
+	defer m.lock()()
+
+	merge, ok := m.state.merges[id]
+	if !ok {
+		return nil
+	}
+	previous := merge
+	merge.RevertedAt = &revertedAt
+	m.state.merges[id] = merge
+	m.state.onRollback(func() { m.state.merges[id] = previous })
+	return nil
+}
+
+func (m *MemoryStore) HasEventsAfter(eventID int, contactIDs []int) (bool, error) {
+	defer m.lock()()
+
+	if eventID < 0 {
+		eventID = 0
+	}
+	concerns := func(id *int) bool {
+		return id != nil && slices.Contains(contactIDs, *id)
+	}
+	for _, event := range m.state.events[min(eventID, len(m.state.events)):] {
+		if slices.Contains(contactIDs, event.ContactID) || concerns(event.LinkedID) || concerns(event.PreviousLinkedID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/internal/normalize"
+	"testing"
+)
+
+func TestMemoryStore_IdentifyAndRevert(t *testing.T) {
+	normalizer, err := normalize.New(normalize.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	service := NewIdentityService(NewMemoryStore(), normalizer, nil)
+
+	for _, req := range []*models.IdentifyRequest{
+		{Email: stringPtr("lorraine@hillvalley.edu"), PhoneNumber: phonePtr("123456")},
+		{Email: stringPtr("mcfly@hillvalley.edu"), PhoneNumber: phonePtr("717171")},
+	} {
+		if _, err := service.IdentifyContact(req); err != nil {
+			t.Fatalf("IdentifyContact() error = %v", err)
+		}
+	}
+
+	// Joins the two identities; the older primary wins.
+	response, err := service.IdentifyContact(&models.IdentifyRequest{
+		Email:       stringPtr("lorraine@hillvalley.edu"),
+		PhoneNumber: phonePtr("717171"),
+	})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+	if response.Contact.PrimaryContactID != 1 || len(response.Contact.SecondaryContactIDs) != 1 {
+		t.Fatalf("Unexpected merged identity %+v", response.Contact)
+	}
+
+	reverted, err := service.RevertMerge(1)
+	if err != nil {
+		t.Fatalf("RevertMerge() error = %v", err)
+	}
+	if len(reverted.Identities) != 2 {
+		t.Errorf("Expected 2 identities after the revert, got %+v", reverted.Identities)
+	}
+}
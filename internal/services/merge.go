@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidMerge is returned when a manual merge request is malformed.
+	ErrInvalidMerge = newError(utils.KindValidation, "invalid_merge", "invalid merge")
+	// ErrMergeBlocked is returned when a do-not-link rule keeps the two
+	// identities apart.
+	ErrMergeBlocked = newError(utils.KindConflict, "merge_blocked", "identities are kept apart by a do-not-link rule")
+	// ErrMergeNotFound is returned when a merge ID does not exist.
+	ErrMergeNotFound = newError(utils.KindNotFound, "merge_not_found", "merge not found")
+	// ErrMergeReverted is returned when a merge has already been reverted.
+	ErrMergeReverted = newError(utils.KindConflict, "merge_reverted", "merge has already been reverted")
+	// ErrMergeHasDependents is returned when contacts touched by a merge have
+	// changed since, so reverting it would undo more than the merge.
+	ErrMergeHasDependents = newError(utils.KindConflict, "merge_has_dependents", "later changes depend on the merge")
+)
+
+// MergeIdentities merges the identities of two primary contacts without an
+// identifying request. It follows the same rules as a merge triggered by
+// IdentifyContact: the older primary wins and every other contact is linked
+// directly to it. The merge and whoever triggered it are recorded, so it
+// can be reverted like any other merge.
+func (s *IdentityService) MergeIdentities(primaryIDs []int, triggeredBy string) (*models.MergeResponse, error) {
+	triggeredBy = strings.TrimSpace(triggeredBy)
+	if len(primaryIDs) != 2 {
+		return nil, invalid(ErrInvalidMerge, fieldError("primaryIds", "exactly two primary IDs are required"))
+	}
+	if primaryIDs[0] == primaryIDs[1] {
+		return nil, invalid(ErrInvalidMerge, fieldError("primaryIds", "cannot merge an identity with itself"))
+	}
+	if triggeredBy == "" {
+		return nil, invalid(ErrInvalidMerge, fieldError("triggeredBy", "triggeredBy is required"))
+	}
+
+	var response *models.MergeResponse
+	err := s.store.WithTx(func(store ContactStore) error {
+		if err := store.LockAll(); err != nil {
+			return err
+		}
+		var err error
+		response, err = s.withStore(store).mergeIdentities(primaryIDs, triggeredBy)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (s *IdentityService) mergeIdentities(primaryIDs []int, triggeredBy string) (*models.MergeResponse, error) {
+	plan := &identifyPlan{}
+	var ids []int
+	// identity maps every loaded contact to the primary it was loaded for.
+	identity := make(map[int]int)
+	for _, primaryID := range primaryIDs {
+		primary, err := s.store.FindByID(primaryID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading contact: %w", err)
+		}
+		if primary == nil || primary.LinkPrecedence != "primary" {
+			return nil, fmt.Errorf("%w: primary contact %d", ErrContactNotFound, primaryID)
+		}
+
+		cluster, err := s.getAllContactsInGroup(primaryID)
+		if err != nil {
+			return nil, err
+		}
+		plan.contacts = append(plan.contacts, cluster...)
+		for _, contact := range cluster {
+			ids = append(ids, contact.ID)
+			identity[contact.ID] = primaryID
+		}
+	}
+
+	exclusions, err := s.store.FindLinkExclusions(ids)
+	if err != nil {
+		return nil, fmt.Errorf("error loading do-not-link rules: %w", err)
+	}
+	for _, rule := range exclusions {
+		if identity[rule[0]] != identity[rule[1]] {
+			return nil, ErrMergeBlocked
+		}
+	}
+
+	contactGroups := s.groupContactsByPrimary(plan.contacts)
+	if _, err := s.mergeContactGroups(plan, contactGroups); err != nil {
+		return nil, err
+	}
+	if err := s.applyPlan(plan); err != nil {
+		return nil, err
+	}
+
+	mergeID, err := s.recordMerge(plan, triggeredBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MergeResponse{
+		MergeID: mergeID,
+		Contact: s.buildResponse(plan.contacts).Contact,
+	}, nil
+}
+
+// recordMerge records an applied plan that merged clusters, with the link
+// every contact had before, and returns the merge's ID.
+func (s *IdentityService) recordMerge(plan *identifyPlan, triggeredBy string) (int, error) {
+	merge := &models.Merge{
+		PrimaryContactID: plan.mergedInto,
+		TriggeredBy:      triggeredBy,
+	}
+	for i, write := range plan.writes {
+		change := models.MergeContact{
+			ContactID:      write.ContactID,
+			LinkedID:       write.LinkedID,
+			LinkPrecedence: write.LinkPrecedence,
+		}
+		if previous := plan.previous[i]; previous != nil {
+			change.PreviousLinkedID = previous.linkedID
+			change.PreviousLinkPrecedence = &previous.linkPrecedence
+		}
+		merge.Contacts = append(merge.Contacts, change)
+	}
+
+	if err := s.store.CreateMerge(merge); err != nil {
+		return 0, fmt.Errorf("error recording merge: %w", err)
+	}
+	return merge.ID, nil
+}
+
+// RevertMerge puts every contact touched by a merge back on the link it had
+// before, and soft-deletes the contact the merging request created, if any.
+// It refuses when a contact touched by the merge, or its winning primary,
+// has changed since, because reverting would then also undo or strand
+// those later changes.
+func (s *IdentityService) RevertMerge(mergeID int) (*models.RevertResponse, error) {
+	var response *models.RevertResponse
+	err := s.store.WithTx(func(store ContactStore) error {
+		if err := store.LockAll(); err != nil {
+			return err
+		}
+		var err error
+		response, err = s.withStore(store).revertMerge(mergeID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (s *IdentityService) revertMerge(mergeID int) (*models.RevertResponse, error) {
+	merge, err := s.store.FindMergeByID(mergeID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading merge: %w", err)
+	}
+	if merge == nil {
+		return nil, ErrMergeNotFound
+	}
+	if merge.RevertedAt != nil {
+		return nil, ErrMergeReverted
+	}
+
+	touched := []int{merge.PrimaryContactID}
+	for _, change := range merge.Contacts {
+		touched = append(touched, change.ContactID)
+	}
+	dependents, err := s.store.HasEventsAfter(merge.LastEventID, touched)
+	if err != nil {
+		return nil, fmt.Errorf("error checking later changes: %w", err)
+	}
+	if dependents {
+		return nil, ErrMergeHasDependents
+	}
+
+	var primaryIDs []int
+	for i := len(merge.Contacts) - 1; i >= 0; i-- {
+		change := merge.Contacts[i]
+		if change.PreviousLinkPrecedence == nil {
+			if err := s.store.SoftDelete(change.ContactID); err != nil {
+				return nil, fmt.Errorf("error deleting contact: %w", err)
+			}
+			continue
+		}
+
+		err := s.store.RestoreLink(change.ContactID, change.PreviousLinkedID, *change.PreviousLinkPrecedence)
+		if err != nil {
+			return nil, fmt.Errorf("error restoring contact: %w", err)
+		}
+
+		primaryID := change.ContactID
+		if change.PreviousLinkedID != nil {
+			primaryID = *change.PreviousLinkedID
+		}
+		primaryIDs = append(primaryIDs, primaryID)
+	}
+	primaryIDs = append(primaryIDs, merge.PrimaryContactID)
+
+	if err := s.store.MarkMergeReverted(merge.ID, time.Now()); err != nil {
+		return nil, fmt.Errorf("error marking merge reverted: %w", err)
+	}
+
+	sort.Ints(primaryIDs)
+	identities := []models.ContactInfo{}
+	for i, primaryID := range primaryIDs {
+		if i > 0 && primaryID == primaryIDs[i-1] {
+			continue
+		}
+		contacts, err := s.getAllContactsInGroup(primaryID)
+		if err != nil {
+			return nil, err
+		}
+		if response := s.buildResponse(contacts); response != nil {
+			identities = append(identities, response.Contact)
+		}
+	}
+
+	return &models.RevertResponse{
+		MergeID:    merge.ID,
+		Identities: identities,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIdentityService_MergeIdentities(t *testing.T) {
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at) VALUES
+			(1, 'lorraine@hillvalley.edu', '123456', NULL, 'primary', '2023-04-01 00:00:00'),
+			(2, 'mcfly@hillvalley.edu', '123456', 1, 'secondary', '2023-04-20 05:30:00'),
+			(3, 'calvin@kleinmail.com', '555', NULL, 'primary', '2023-03-01 00:00:00'),
+			(4, 'calvin@kleinmail.com', '777', 3, 'secondary', '2023-03-02 00:00:00');
+	`)
+
+	response, err := service.MergeIdentities([]int{1, 3}, "jane@support")
+	if err != nil {
+		t.Fatalf("MergeIdentities() error = %v", err)
+	}
+
+	if response.Contact.PrimaryContactID != 3 {
+		t.Errorf("Expected the older primary 3 to win, got %d", response.Contact.PrimaryContactID)
+	}
+	if !reflect.DeepEqual(response.Contact.SecondaryContactIDs, []int{4, 1, 2}) {
+		t.Errorf("Expected secondaries [4 1 2], got %v", response.Contact.SecondaryContactIDs)
+	}
+
+	merge, err := service.store.FindMergeByID(response.MergeID)
+	if err != nil || merge == nil {
+		t.Fatalf("Failed to load merge record: %v", err)
+	}
+	if merge.PrimaryContactID != 3 || merge.TriggeredBy != "jane@support" {
+		t.Errorf("Unexpected merge record %+v", merge)
+	}
+	var changed []int
+	for _, change := range merge.Contacts {
+		changed = append(changed, change.ContactID)
+	}
+	if !reflect.DeepEqual(changed, []int{1, 2}) {
+		t.Errorf("Expected the merge to record contacts [1 2], got %v", changed)
+	}
+
+	contact, err := service.GetContact(2)
+	if err != nil {
+		t.Fatalf("GetContact() error = %v", err)
+	}
+	if contact.Contact.PrimaryContactID != 3 {
+		t.Errorf("Expected contact 2 to resolve to primary 3, got %d", contact.Contact.PrimaryContactID)
+	}
+}
+
+func TestIdentityService_MergeIdentitiesRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		primaryIDs  []int
+		triggeredBy string
+		wantErr     error
+	}{
+		{"One ID", []int{1}, "jane@support", ErrInvalidMerge},
+		{"Same ID twice", []int{1, 1}, "jane@support", ErrInvalidMerge},
+		{"Missing triggeredBy", []int{1, 3}, " ", ErrInvalidMerge},
+		{"Secondary instead of primary", []int{1, 2}, "jane@support", ErrContactNotFound},
+		{"Unknown primary", []int{1, 99}, "jane@support", ErrContactNotFound},
+		{"Split identities", []int{1, 5}, "jane@support", ErrMergeBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			execSQL(t, db, `
+				INSERT INTO contacts (id, email, linked_id, link_precedence) VALUES
+					(1, 'lorraine@hillvalley.edu', NULL, 'primary'),
+					(2, 'mcfly@hillvalley.edu', 1, 'secondary'),
+					(3, 'calvin@kleinmail.com', NULL, 'primary'),
+					(5, 'biff@hillvalley.edu', NULL, 'primary');
+				INSERT INTO link_exclusions (contact_id, excluded_contact_id) VALUES (5, 2);
+			`)
+
+			if _, err := service.MergeIdentities(tt.primaryIDs, tt.triggeredBy); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+
+			var merges int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM merges`).Scan(&merges); err != nil {
+				t.Fatalf("Failed to count merges: %v", err)
+			}
+			if merges != 0 {
+				t.Errorf("Expected no merge to be recorded, got %d", merges)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"fmt"
+	"slices"
+)
+
+// identifyPlan is the outcome of reconciling a request against the stored
+// contacts: the writes it needs and the cluster as it looks once they are
+// made. Planning only reads, so the same plan backs both IdentifyContact,
+// which applies it, and LookupContact, which only reports it.
+type identifyPlan struct {
+	contacts []models.Contact
+	writes   []models.ContactWrite
+	// targets[i] is the index in contacts that writes[i] applies to.
+	targets []int
+	// previous[i] is the link writes[i] replaces, nil for created contacts.
+	previous []*linkSnapshot
+	// mergedInto is the winning primary when the plan merges clusters.
+	mergedInto int
+	// clusters are the primaries of the stored contacts as they were read,
+	// before any planned write.
+	clusters []int
+}
+
+// linkSnapshot is a contact's link before a planned write.
+type linkSnapshot struct {
+	linkedID       *int
+	linkPrecedence string
+}
+
+func (p *identifyPlan) snapshot(i int) *linkSnapshot {
+	return &linkSnapshot{
+		linkedID:       p.contacts[i].LinkedID,
+		linkPrecedence: p.contacts[i].LinkPrecedence,
+	}
+}
+
+func (s *IdentityService) planIdentify(req *models.IdentifyRequest) (*identifyPlan, error) {
+	blocked, err := s.loadBlocklist()
+	if err != nil {
+		return nil, err
+	}
+	if (req.NormalizedEmail == nil || blocked.blocksEmail(req.NormalizedEmail)) &&
+		(req.NormalizedPhoneNumber == nil || blocked.blocksPhone(req.NormalizedPhoneNumber)) {
+		return nil, ErrIdentifiersBlocked
+	}
+
+	existingContacts, err := s.resolveIdentity(req, blocked)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &identifyPlan{contacts: existingContacts}
+	for _, contact := range existingContacts {
+		primaryID := contact.ID
+		if contact.LinkedID != nil {
+			primaryID = *contact.LinkedID
+		}
+		if !slices.Contains(plan.clusters, primaryID) {
+			plan.clusters = append(plan.clusters, primaryID)
+		}
+	}
+
+	if len(existingContacts) == 0 {
+		plan.create(newContactFromRequest(req, nil, "primary"))
+		return plan, nil
+	}
+
+	contactGroups := s.groupContactsByPrimary(existingContacts)
+	primaryID := s.getPrimaryContactID(contactGroups)
+
+	// A single cluster whose primary is gone goes through the merge too, so
+	// that one of its secondaries is promoted.
+	if len(contactGroups) > 1 || !hasContact(plan.contacts, primaryID) {
+		if primaryID, err = s.mergeContactGroups(plan, contactGroups); err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.contactExistsWithExactMatch(plan.contacts, req) && s.hasNewInformation(plan.contacts, req) {
+		plan.create(newContactFromRequest(req, &primaryID, "secondary"))
+	}
+
+	return plan, nil
+}
+
+// link plans making contacts[i] a secondary of primaryID.
+func (p *identifyPlan) link(i int, primaryID int) {
+	p.previous = append(p.previous, p.snapshot(i))
+	p.contacts[i].LinkedID = &primaryID
+	p.contacts[i].LinkPrecedence = "secondary"
+
+	p.writes = append(p.writes, models.ContactWrite{
+		Operation:      models.WriteUpdate,
+		ContactID:      p.contacts[i].ID,
+		LinkedID:       &primaryID,
+		LinkPrecedence: "secondary",
+	})
+	p.targets = append(p.targets, i)
+}
+
+// promote plans making contacts[i] a primary.
+func (p *identifyPlan) promote(i int) {
+	p.previous = append(p.previous, p.snapshot(i))
+	p.contacts[i].LinkedID = nil
+	p.contacts[i].LinkPrecedence = "primary"
+
+	p.writes = append(p.writes, models.ContactWrite{
+		Operation:      models.WriteUpdate,
+		ContactID:      p.contacts[i].ID,
+		LinkPrecedence: "primary",
+	})
+	p.targets = append(p.targets, i)
+}
+
+// create plans storing a new contact.
+func (p *identifyPlan) create(contact models.Contact) {
+	p.previous = append(p.previous, nil)
+	p.contacts = append(p.contacts, contact)
+
+	p.writes = append(p.writes, models.ContactWrite{
+		Operation:      models.WriteCreate,
+		Email:          contact.Email,
+		PhoneNumber:    contact.PhoneNumber,
+		LinkedID:       contact.LinkedID,
+		LinkPrecedence: contact.LinkPrecedence,
+	})
+	p.targets = append(p.targets, len(p.contacts)-1)
+}
+
+// applyPlan performs the planned writes in order, filling in the IDs of
+// created contacts.
+func (s *IdentityService) applyPlan(plan *identifyPlan) error {
+	for i := range plan.writes {
+		write := &plan.writes[i]
+		contact := &plan.contacts[plan.targets[i]]
+
+		switch write.Operation {
+		case models.WriteCreate:
+			if err := s.store.Create(contact); err != nil {
+				return fmt.Errorf("error creating %s contact: %w", contact.LinkPrecedence, err)
+			}
+			write.ContactID = contact.ID
+		case models.WriteUpdate:
+			if err := s.store.UpdateLinkPrecedence(contact.ID, contact.LinkedID, contact.LinkPrecedence); err != nil {
+				return fmt.Errorf("error updating contact precedence: %w", err)
+			}
+		default:
+			return fmt.Errorf("unknown write operation %q", write.Operation)
+		}
+	}
+
+	return nil
+}
+
+func hasContact(contacts []models.Contact, id int) bool {
+	for _, contact := range contacts {
+		if contact.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func newContactFromRequest(req *models.IdentifyRequest, linkedID *int, linkPrecedence string) models.Contact {
+	return models.Contact{
+		PhoneNumber:           req.PhoneNumber,
+		Email:                 req.Email,
+		NormalizedPhoneNumber: req.NormalizedPhoneNumber,
+		NormalizedEmail:       req.NormalizedEmail,
+		LinkedID:              linkedID,
+		LinkPrecedence:        linkPrecedence,
+	}
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"fmt"
+	"sort"
+)
+
+// requestNodeID stands in for the incoming request in the contact graph.
+// Real contacts always have positive IDs.
+const requestNodeID = 0
+
+// unionFind is a disjoint-set forest over contact IDs.
+type unionFind struct {
+	parent map[int]int
+	rank   map[int]int
+}
+
+func newUnionFind() *unionFind {
+	return &unionFind{
+		parent: make(map[int]int),
+		rank:   make(map[int]int),
+	}
+}
+
+func (u *unionFind) find(x int) int {
+	if _, ok := u.parent[x]; !ok {
+		u.parent[x] = x
+		return x
+	}
+	for u.parent[x] != x {
+		u.parent[x] = u.parent[u.parent[x]]
+		x = u.parent[x]
+	}
+	return x
+}
+
+func (u *unionFind) union(a, b int) {
+	rootA, rootB := u.find(a), u.find(b)
+	if rootA == rootB {
+		return
+	}
+	switch {
+	case u.rank[rootA] < u.rank[rootB]:
+		u.parent[rootA] = rootB
+	case u.rank[rootA] > u.rank[rootB]:
+		u.parent[rootB] = rootA
+	default:
+		u.parent[rootB] = rootA
+		u.rank[rootA]++
+	}
+}
+
+// contactGraph connects contacts that share an email, a phone number or a
+// link to the same primary. Do-not-link rules are pairs of contacts whose
+// sets must never be joined by a shared identifier. Blocklisted
+// identifiers join nothing.
+type contactGraph struct {
+	sets       *unionFind
+	exclusions [][2]int
+	blocked    *blocklist
+}
+
+func newContactGraph(exclusions [][2]int, blocked *blocklist) *contactGraph {
+	return &contactGraph{
+		sets:       newUnionFind(),
+		exclusions: exclusions,
+		blocked:    blocked,
+	}
+}
+
+// union joins the sets of a and b unless a do-not-link rule separates them.
+func (g *contactGraph) union(a, b int) {
+	rootA, rootB := g.sets.find(a), g.sets.find(b)
+	if rootA == rootB {
+		return
+	}
+	for _, rule := range g.exclusions {
+		x, y := g.sets.find(rule[0]), g.sets.find(rule[1])
+		if (x == rootA && y == rootB) || (x == rootB && y == rootA) {
+			return
+		}
+	}
+	g.sets.union(a, b)
+}
+
+// linkClusters joins every contact to its primary. Existing links always
+// hold, whatever the rules say.
+func (g *contactGraph) linkClusters(contacts []models.Contact) {
+	for _, contact := range contacts {
+		g.sets.find(contact.ID)
+		if contact.LinkedID != nil {
+			g.sets.union(contact.ID, *contact.LinkedID)
+		}
+	}
+}
+
+// linkRequest joins the request node to the contacts it matches, email
+// matches first, so that when rules allow only some of the matches the
+// request stays with the contacts it shares its email with.
+func (g *contactGraph) linkRequest(req *models.IdentifyRequest, contacts []models.Contact) {
+	g.sets.find(requestNodeID)
+	email, phone := req.NormalizedEmail, req.NormalizedPhoneNumber
+	if g.blocked.blocksEmail(email) {
+		email = nil
+	}
+	if g.blocked.blocksPhone(phone) {
+		phone = nil
+	}
+
+	for _, contact := range contacts {
+		if sameIdentifier(email, contact.NormalizedEmail) {
+			g.union(requestNodeID, contact.ID)
+		}
+	}
+	for _, contact := range contacts {
+		if sameIdentifier(phone, contact.NormalizedPhoneNumber) {
+			g.union(requestNodeID, contact.ID)
+		}
+	}
+}
+
+// linkIdentifiers joins contacts that share an email or a phone number.
+func (g *contactGraph) linkIdentifiers(contacts []models.Contact) {
+	byEmail := make(map[string][]int)
+	byPhone := make(map[string][]int)
+
+	for _, contact := range contacts {
+		g.sets.find(contact.ID)
+		if email := contact.NormalizedEmail; email != nil && *email != "" && !g.blocked.blocksEmail(email) {
+			for _, other := range byEmail[*email] {
+				g.union(contact.ID, other)
+			}
+			byEmail[*email] = append(byEmail[*email], contact.ID)
+		}
+		if phone := contact.NormalizedPhoneNumber; phone != nil && *phone != "" && !g.blocked.blocksPhone(phone) {
+			for _, other := range byPhone[*phone] {
+				g.union(contact.ID, other)
+			}
+			byPhone[*phone] = append(byPhone[*phone], contact.ID)
+		}
+	}
+}
+
+func sameIdentifier(a, b *string) bool {
+	return a != nil && b != nil && *a != "" && *a == *b
+}
+
+// resolveIdentity returns every stored contact in the same connected
+// component as the request. It follows email and phone edges outward from the
+// request's identifiers, loading whole clusters as it reaches them, until no
+// new identifier turns up, so clusters joined only through a third cluster
+// are still found. Do-not-link rules between the loaded contacts can keep
+// part of what was reached out of the component, and blocklisted identifiers
+// are neither followed nor used as edges.
+func (s *IdentityService) resolveIdentity(req *models.IdentifyRequest, blocked *blocklist) ([]models.Contact, error) {
+	contacts := make(map[int]models.Contact)
+	var order []int
+	loadedClusters := make(map[int]bool)
+	seenEmails := make(map[string]bool)
+	seenPhones := make(map[string]bool)
+
+	var pendingEmails, pendingPhones []string
+	queueIdentifiers := func(email, phoneNumber *string) {
+		if email != nil && *email != "" && !seenEmails[*email] && !blocked.blocksEmail(email) {
+			seenEmails[*email] = true
+			pendingEmails = append(pendingEmails, *email)
+		}
+		if phoneNumber != nil && *phoneNumber != "" && !seenPhones[*phoneNumber] && !blocked.blocksPhone(phoneNumber) {
+			seenPhones[*phoneNumber] = true
+			pendingPhones = append(pendingPhones, *phoneNumber)
+		}
+	}
+	addContacts := func(found []models.Contact) {
+		for _, contact := range found {
+			if _, ok := contacts[contact.ID]; ok {
+				continue
+			}
+			contacts[contact.ID] = contact
+			order = append(order, contact.ID)
+			queueIdentifiers(contact.NormalizedEmail, contact.NormalizedPhoneNumber)
+		}
+	}
+
+	queueIdentifiers(req.NormalizedEmail, req.NormalizedPhoneNumber)
+
+	for len(pendingEmails) > 0 || len(pendingPhones) > 0 {
+		var email, phoneNumber *string
+		if len(pendingEmails) > 0 {
+			email = &pendingEmails[0]
+			pendingEmails = pendingEmails[1:]
+		}
+		if len(pendingPhones) > 0 {
+			phoneNumber = &pendingPhones[0]
+			pendingPhones = pendingPhones[1:]
+		}
+
+		found, err := s.store.FindByEmailOrPhone(email, phoneNumber)
+		if err != nil {
+			return nil, fmt.Errorf("error finding existing contacts: %w", err)
+		}
+		addContacts(found)
+
+		for _, contact := range found {
+			primaryID := contact.ID
+			if contact.LinkedID != nil {
+				primaryID = *contact.LinkedID
+			}
+			if loadedClusters[primaryID] {
+				continue
+			}
+			loadedClusters[primaryID] = true
+
+			cluster, err := s.getAllContactsInGroup(primaryID)
+			if err != nil {
+				return nil, err
+			}
+			addContacts(cluster)
+		}
+	}
+
+	loaded := make([]models.Contact, 0, len(order))
+	ids := make([]int, 0, len(order))
+	for _, id := range order {
+		loaded = append(loaded, contacts[id])
+		ids = append(ids, id)
+	}
+	// Older contacts claim shared identifiers first when rules force a choice.
+	sort.SliceStable(loaded, func(i, j int) bool {
+		if loaded[i].CreatedAt.Equal(loaded[j].CreatedAt) {
+			return loaded[i].ID < loaded[j].ID
+		}
+		return loaded[i].CreatedAt.Before(loaded[j].CreatedAt)
+	})
+
+	exclusions, err := s.store.FindLinkExclusions(ids)
+	if err != nil {
+		return nil, fmt.Errorf("error loading do-not-link rules: %w", err)
+	}
+
+	graph := newContactGraph(exclusions, blocked)
+	graph.linkClusters(loaded)
+	graph.linkRequest(req, loaded)
+	graph.linkIdentifiers(loaded)
+
+	requestRoot := graph.sets.find(requestNodeID)
+	var component []models.Contact
+	for _, contact := range loaded {
+		if graph.sets.find(contact.ID) == requestRoot {
+			component = append(component, contact)
+		}
+	}
+
+	return component, nil
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestResolveIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		contacts   []models.Contact
+		exclusions [][2]int
+		request    models.IdentifyRequest
+		want       []int
+	}{
+		{
+			name: "Unrelated contacts stay apart",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr("a@example.com"), NormalizedPhoneNumber: stringPtr("111")},
+				{NormalizedEmail: stringPtr("b@example.com"), NormalizedPhoneNumber: stringPtr("222")},
+			},
+			request: models.IdentifyRequest{NormalizedEmail: stringPtr("a@example.com")},
+			want:    []int{1},
+		},
+		{
+			name: "Shared phone number joins contacts",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr("a@example.com"), NormalizedPhoneNumber: stringPtr("111")},
+				{NormalizedEmail: stringPtr("b@example.com"), NormalizedPhoneNumber: stringPtr("111")},
+			},
+			request: models.IdentifyRequest{NormalizedEmail: stringPtr("a@example.com")},
+			want:    []int{1, 2},
+		},
+		{
+			name: "Link joins contacts without shared identifiers",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr("a@example.com")},
+				{NormalizedPhoneNumber: stringPtr("222"), LinkedID: intPtr(1)},
+			},
+			request: models.IdentifyRequest{NormalizedEmail: stringPtr("a@example.com")},
+			want:    []int{1, 2},
+		},
+		{
+			name: "Three-way chain through email then phone",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr("a@example.com"), NormalizedPhoneNumber: stringPtr("111")},
+				{NormalizedEmail: stringPtr("a@example.com"), NormalizedPhoneNumber: stringPtr("222")},
+				{NormalizedEmail: stringPtr("c@example.com"), NormalizedPhoneNumber: stringPtr("222")},
+				{NormalizedEmail: stringPtr("d@example.com"), NormalizedPhoneNumber: stringPtr("444")},
+			},
+			request: models.IdentifyRequest{NormalizedEmail: stringPtr("a@example.com")},
+			want:    []int{1, 2, 3},
+		},
+		{
+			name: "Four-way chain mixing links and identifiers",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr("a@example.com")},
+				{NormalizedPhoneNumber: stringPtr("222"), LinkedID: intPtr(1)},
+				{NormalizedEmail: stringPtr("c@example.com"), NormalizedPhoneNumber: stringPtr("222")},
+				{NormalizedEmail: stringPtr("c@example.com"), NormalizedPhoneNumber: stringPtr("444")},
+				{NormalizedPhoneNumber: stringPtr("444")},
+			},
+			request: models.IdentifyRequest{NormalizedPhoneNumber: stringPtr("444")},
+			want:    []int{1, 2, 3, 4, 5},
+		},
+		{
+			name: "Do-not-link rule keeps clusters sharing a phone apart",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr("a@example.com"), NormalizedPhoneNumber: stringPtr("111")},
+				{NormalizedEmail: stringPtr("b@example.com"), NormalizedPhoneNumber: stringPtr("111")},
+				{NormalizedEmail: stringPtr("b@example.com"), LinkedID: intPtr(2)},
+			},
+			exclusions: [][2]int{{2, 1}},
+			request:    models.IdentifyRequest{NormalizedEmail: stringPtr("b@example.com")},
+			want:       []int{2, 3},
+		},
+		{
+			name: "Do-not-link rule applies across a third cluster",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr("a@example.com"), NormalizedPhoneNumber: stringPtr("111")},
+				{NormalizedEmail: stringPtr("c@example.com"), NormalizedPhoneNumber: stringPtr("111")},
+				{NormalizedEmail: stringPtr("c@example.com"), NormalizedPhoneNumber: stringPtr("333")},
+			},
+			exclusions: [][2]int{{1, 3}},
+			request:    models.IdentifyRequest{NormalizedEmail: stringPtr("a@example.com")},
+			want:       []int{1, 2},
+		},
+		{
+			name: "Request joins clusters a rule keeps apart by email first",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr("a@example.com")},
+				{NormalizedPhoneNumber: stringPtr("222")},
+			},
+			exclusions: [][2]int{{1, 2}},
+			request:    models.IdentifyRequest{NormalizedEmail: stringPtr("a@example.com"), NormalizedPhoneNumber: stringPtr("222")},
+			want:       []int{1},
+		},
+		{
+			name: "Empty identifiers do not join contacts",
+			contacts: []models.Contact{
+				{NormalizedEmail: stringPtr(""), NormalizedPhoneNumber: stringPtr("111")},
+				{NormalizedEmail: stringPtr(""), NormalizedPhoneNumber: stringPtr("222")},
+			},
+			request: models.IdentifyRequest{NormalizedEmail: stringPtr(""), NormalizedPhoneNumber: stringPtr("111")},
+			want:    []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			for _, contact := range tt.contacts {
+				contact.LinkPrecedence = "primary"
+				if contact.LinkedID != nil {
+					contact.LinkPrecedence = "secondary"
+				}
+				if err := store.Create(&contact); err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+			}
+			for _, rule := range tt.exclusions {
+				if err := store.CreateLinkExclusion(rule[0], rule[1]); err != nil {
+					t.Fatalf("CreateLinkExclusion() error = %v", err)
+				}
+			}
+			service := NewIdentityService(store, nil, nil)
+
+			component, err := service.resolveIdentity(&tt.request, nil)
+			if err != nil {
+				t.Fatalf("resolveIdentity() error = %v", err)
+			}
+			var got []int
+			for _, contact := range component {
+				got = append(got, contact.ID)
+			}
+			sort.Ints(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveIdentity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityService_TransitiveMerge(t *testing.T) {
+	tests := []struct {
+		name            string
+		seed            string
+		request         *models.IdentifyRequest
+		wantPrimary     int
+		wantSecondaries []int
+		wantEmails      int
+	}{
+		{
+			// 1 and 2 share an email, 3 is only reachable through 2's phone.
+			name: "Three-way merge",
+			seed: `
+				INSERT INTO contacts (id, email, phone_number, link_precedence, created_at) VALUES
+					(1, 'doc@hillvalley.edu', '111', 'primary', '2023-04-01 00:00:00'),
+					(2, 'doc@hillvalley.edu', '222', 'primary', '2023-04-02 00:00:00'),
+					(3, 'emmett@hillvalley.edu', '222', 'primary', '2023-04-03 00:00:00');
+			`,
+			request: &models.IdentifyRequest{
+				Email:       stringPtr("doc@hillvalley.edu"),
+				PhoneNumber: phonePtr("111"),
+			},
+			wantPrimary:     1,
+			wantSecondaries: []int{2, 3},
+			wantEmails:      2,
+		},
+		{
+			// The request hits 4 directly; 3, 2 and 1 follow through a
+			// chain of shared phone numbers, emails and a secondary link.
+			name: "Four-way merge",
+			seed: `
+				INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at) VALUES
+					(1, 'lorraine@hillvalley.edu', '111', NULL, 'primary', '2023-04-01 00:00:00'),
+					(2, 'marty@hillvalley.edu', '222', NULL, 'primary', '2023-04-02 00:00:00'),
+					(5, 'marty@hillvalley.edu', '111', 1, 'secondary', '2023-04-02 12:00:00'),
+					(3, 'george@hillvalley.edu', '222', NULL, 'primary', '2023-04-03 00:00:00'),
+					(4, 'george@hillvalley.edu', '444', NULL, 'primary', '2023-04-04 00:00:00');
+			`,
+			request: &models.IdentifyRequest{
+				PhoneNumber: phonePtr("444"),
+			},
+			wantPrimary:     1,
+			wantSecondaries: []int{2, 5, 3, 4},
+			wantEmails:      3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			execSQL(t, db, tt.seed)
+
+			response, err := service.IdentifyContact(tt.request)
+			if err != nil {
+				t.Fatalf("IdentifyContact() error = %v", err)
+			}
+
+			if response.Contact.PrimaryContactID != tt.wantPrimary {
+				t.Errorf("Expected primary %d, got %d", tt.wantPrimary, response.Contact.PrimaryContactID)
+			}
+
+			got := append([]int(nil), response.Contact.SecondaryContactIDs...)
+			want := append([]int(nil), tt.wantSecondaries...)
+			sort.Ints(got)
+			sort.Ints(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected secondaries %v, got %v", tt.wantSecondaries, response.Contact.SecondaryContactIDs)
+			}
+
+			if len(response.Contact.Emails) != tt.wantEmails {
+				t.Errorf("Expected %d emails, got %v", tt.wantEmails, response.Contact.Emails)
+			}
+
+			var primaries int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM contacts WHERE link_precedence = 'primary'`).Scan(&primaries); err != nil {
+				t.Fatalf("Failed to count primaries: %v", err)
+			}
+			if primaries != 1 {
+				t.Errorf("Expected a single primary after merge, got %d", primaries)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
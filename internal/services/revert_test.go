@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"errors"
+	"testing"
+)
+
+func TestIdentityService_RevertMerge(t *testing.T) {
+	service, db := newTestService(t)
+
+	// Two primaries sharing an email, left apart by legacy data. The next
+	// request merges them and adds contact 3.
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at) VALUES
+			(1, 'doc@hillvalley.edu', '111', NULL, 'primary', '2023-04-01 00:00:00'),
+			(2, 'doc@hillvalley.edu', '222', NULL, 'primary', '2023-04-02 00:00:00'),
+			(4, 'einstein@hillvalley.edu', '222', 2, 'secondary', '2023-04-03 00:00:00');
+	`)
+
+	response, err := service.IdentifyContact(&models.IdentifyRequest{Email: stringPtr("doc@hillvalley.edu"), PhoneNumber: phonePtr("999")})
+	if err != nil {
+		t.Fatalf("IdentifyContact() error = %v", err)
+	}
+	if response.Contact.PrimaryContactID != 1 || len(response.Contact.SecondaryContactIDs) != 3 {
+		t.Fatalf("Expected one merged identity, got %+v", response.Contact)
+	}
+
+	var mergeID int
+	var triggeredBy string
+	if err := db.QueryRow(`SELECT id, triggered_by FROM merges`).Scan(&mergeID, &triggeredBy); err != nil {
+		t.Fatalf("Failed to load merge: %v", err)
+	}
+	if triggeredBy != models.MergeTriggeredByIdentify {
+		t.Errorf("Expected merge triggered by %q, got %q", models.MergeTriggeredByIdentify, triggeredBy)
+	}
+
+	reverted, err := service.RevertMerge(mergeID)
+	if err != nil {
+		t.Fatalf("RevertMerge() error = %v", err)
+	}
+	if len(reverted.Identities) != 2 || reverted.Identities[0].PrimaryContactID != 1 || reverted.Identities[1].PrimaryContactID != 2 {
+		t.Fatalf("Expected identities 1 and 2, got %+v", reverted.Identities)
+	}
+	if got := reverted.Identities[1].SecondaryContactIDs; len(got) != 1 || got[0] != 4 {
+		t.Errorf("Expected contact 4 back under primary 2, got %v", got)
+	}
+
+	if _, err := service.GetContact(3); !errors.Is(err, ErrContactNotFound) {
+		t.Errorf("Expected the contact created by the merge to be deleted, got %v", err)
+	}
+
+	history, err := service.GetContactHistory(2)
+	if err != nil {
+		t.Fatalf("GetContactHistory() error = %v", err)
+	}
+	if last := history.Events[len(history.Events)-1]; last.Type != models.EventReverted {
+		t.Errorf("Expected a reverted event last, got %+v", last)
+	}
+
+	if _, err := service.RevertMerge(mergeID); !errors.Is(err, ErrMergeReverted) {
+		t.Errorf("Expected ErrMergeReverted, got %v", err)
+	}
+	if _, err := service.RevertMerge(99); !errors.Is(err, ErrMergeNotFound) {
+		t.Errorf("Expected ErrMergeNotFound, got %v", err)
+	}
+}
+
+func TestIdentityService_RevertMergeRefusesDependents(t *testing.T) {
+	tests := []struct {
+		name  string
+		after func(t *testing.T, service *IdentityService)
+	}{
+		{
+			name: "New secondary linked to the winning primary",
+			after: func(t *testing.T, service *IdentityService) {
+				if _, err := service.IdentifyContact(&models.IdentifyRequest{Email: stringPtr("lorraine@hillvalley.edu"), PhoneNumber: phonePtr("717171")}); err != nil {
+					t.Fatalf("IdentifyContact() error = %v", err)
+				}
+			},
+		},
+		{
+			name: "Demoted primary deleted",
+			after: func(t *testing.T, service *IdentityService) {
+				if err := service.DeleteContact(2); err != nil {
+					t.Fatalf("DeleteContact() error = %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			execSQL(t, db, `
+				INSERT INTO contacts (id, email, linked_id, link_precedence, created_at) VALUES
+					(1, 'lorraine@hillvalley.edu', NULL, 'primary', '2023-04-01 00:00:00'),
+					(2, 'calvin@kleinmail.com', NULL, 'primary', '2023-04-02 00:00:00'),
+					(3, 'biff@hillvalley.edu', NULL, 'primary', '2023-04-03 00:00:00');
+			`)
+
+			merge, err := service.MergeIdentities([]int{1, 2}, "jane@support")
+			if err != nil {
+				t.Fatalf("MergeIdentities() error = %v", err)
+			}
+
+			// Changes to unrelated identities do not block the revert.
+			if err := service.DeleteContact(3); err != nil {
+				t.Fatalf("DeleteContact() error = %v", err)
+			}
+
+			tt.after(t, service)
+
+			if _, err := service.RevertMerge(merge.MergeID); !errors.Is(err, ErrMergeHasDependents) {
+				t.Errorf("Expected ErrMergeHasDependents, got %v", err)
+			}
+
+			var reverted int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM merges WHERE reverted_at IS NOT NULL`).Scan(&reverted); err != nil {
+				t.Fatalf("Failed to count merges: %v", err)
+			}
+			if reverted != 0 {
+				t.Errorf("Expected the merge to stay in place, %d reverted", reverted)
+			}
+		})
+	}
+}
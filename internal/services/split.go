@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"fmt"
+)
+
+// ErrInvalidSplit is returned when the contacts to detach cannot be split
+// off the identity.
+var ErrInvalidSplit = newError(utils.KindValidation, "invalid_split", "invalid split")
+
+// SplitIdentity detaches contactIDs from the identity of primaryID into an
+// identity of their own, headed by the oldest detached contact. If the
+// primary itself is detached, the oldest remaining contact is promoted.
+// A do-not-link rule is recorded between every detached and every remaining
+// contact, so later requests sharing an identifier do not merge the two
+// identities again.
+func (s *IdentityService) SplitIdentity(primaryID int, contactIDs []int) (*models.SplitResponse, error) {
+	var response *models.SplitResponse
+	err := s.store.WithTx(func(store ContactStore) error {
+		if err := store.LockAll(); err != nil {
+			return err
+		}
+		var err error
+		response, err = s.withStore(store).splitIdentity(primaryID, contactIDs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (s *IdentityService) splitIdentity(primaryID int, contactIDs []int) (*models.SplitResponse, error) {
+	primary, err := s.store.FindByID(primaryID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading contact: %w", err)
+	}
+	if primary == nil || primary.LinkPrecedence != "primary" {
+		return nil, ErrContactNotFound
+	}
+
+	if len(contactIDs) == 0 {
+		return nil, invalid(ErrInvalidSplit, fieldError("contactIds", "at least one contact ID is required"))
+	}
+
+	contacts, err := s.getAllContactsInGroup(primaryID)
+	if err != nil {
+		return nil, err
+	}
+
+	detach := make(map[int]bool)
+	for _, id := range contactIDs {
+		if !hasContact(contacts, id) {
+			return nil, invalid(ErrInvalidSplit, fieldError("contactIds",
+				fmt.Sprintf("contact %d is not part of identity %d", id, primaryID)))
+		}
+		detach[id] = true
+	}
+	if len(detach) == len(contacts) {
+		return nil, invalid(ErrInvalidSplit, fieldError("contactIds",
+			fmt.Sprintf("cannot detach every contact of identity %d", primaryID)))
+	}
+
+	var detached, remaining []models.Contact
+	for _, contact := range contacts {
+		if detach[contact.ID] {
+			detached = append(detached, contact)
+		} else {
+			remaining = append(remaining, contact)
+		}
+	}
+
+	if _, err := s.relinkToOldest(remaining); err != nil {
+		return nil, err
+	}
+	if err := s.detach(detached); err != nil {
+		return nil, err
+	}
+
+	for _, d := range detached {
+		for _, r := range remaining {
+			if err := s.store.CreateLinkExclusion(d.ID, r.ID); err != nil {
+				return nil, fmt.Errorf("error recording do-not-link rule: %w", err)
+			}
+		}
+	}
+
+	original, err := s.reloadCluster(remaining)
+	if err != nil {
+		return nil, err
+	}
+	split, err := s.reloadCluster(detached)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SplitResponse{
+		Original: s.buildResponse(original).Contact,
+		Split:    s.buildResponse(split).Contact,
+	}, nil
+}
+
+// detach makes the oldest of contacts the primary of a new identity and
+// links the others to it. Every contact gets a split event, including one
+// whose link does not change.
+func (s *IdentityService) detach(contacts []models.Contact) error {
+	primaryID := contacts[oldestContactIndex(contacts)].ID
+
+	for _, contact := range contacts {
+		var err error
+		if contact.ID == primaryID {
+			err = s.store.DetachContact(contact.ID, nil, "primary")
+		} else {
+			err = s.store.DetachContact(contact.ID, &primaryID, "secondary")
+		}
+		if err != nil {
+			return fmt.Errorf("error detaching contact: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reloadCluster returns the current rows of the cluster headed by the
+// oldest of contacts.
+func (s *IdentityService) reloadCluster(contacts []models.Contact) ([]models.Contact, error) {
+	return s.getAllContactsInGroup(contacts[oldestContactIndex(contacts)].ID)
+}
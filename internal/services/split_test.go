@@ -0,0 +1,134 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// seedFamilyPhone stores two people sharing a family phone number, wrongly
+// merged into one identity.
+func seedFamilyPhone(t *testing.T) (*IdentityService, func() int) {
+	t.Helper()
+	service, db := newTestService(t)
+
+	execSQL(t, db, `
+		INSERT INTO contacts (id, email, phone_number, linked_id, link_precedence, created_at) VALUES
+			(1, 'lorraine@hillvalley.edu', '555', NULL, 'primary', '2023-04-01 00:00:00'),
+			(2, 'marty@hillvalley.edu', '555', 1, 'secondary', '2023-04-02 00:00:00'),
+			(3, 'marty@hillvalley.edu', '777', 1, 'secondary', '2023-04-03 00:00:00');
+	`)
+
+	return service, func() int { return countContacts(t, db) }
+}
+
+func TestIdentityService_SplitIdentity(t *testing.T) {
+	service, count := seedFamilyPhone(t)
+
+	response, err := service.SplitIdentity(1, []int{2, 3})
+	if err != nil {
+		t.Fatalf("SplitIdentity() error = %v", err)
+	}
+	if response.Original.PrimaryContactID != 1 || len(response.Original.SecondaryContactIDs) != 0 {
+		t.Errorf("Expected original identity 1 without secondaries, got %+v", response.Original)
+	}
+	if response.Split.PrimaryContactID != 2 || !reflect.DeepEqual(response.Split.SecondaryContactIDs, []int{3}) {
+		t.Errorf("Expected split identity 2 with secondaries [3], got %+v", response.Split)
+	}
+
+	tests := []struct {
+		name        string
+		request     *models.IdentifyRequest
+		wantPrimary int
+		wantCount   int
+	}{
+		{
+			name:        "Shared phone with detached email stays split",
+			request:     &models.IdentifyRequest{Email: stringPtr("marty@hillvalley.edu"), PhoneNumber: phonePtr("555")},
+			wantPrimary: 2,
+			wantCount:   3,
+		},
+		{
+			name:        "Shared phone with remaining email stays original",
+			request:     &models.IdentifyRequest{Email: stringPtr("lorraine@hillvalley.edu"), PhoneNumber: phonePtr("555")},
+			wantPrimary: 1,
+			wantCount:   3,
+		},
+		{
+			name:        "New email with shared phone joins the oldest identity only",
+			request:     &models.IdentifyRequest{Email: stringPtr("george@hillvalley.edu"), PhoneNumber: phonePtr("555")},
+			wantPrimary: 1,
+			wantCount:   4,
+		},
+		{
+			name:        "Detached identity is not merged through the new contact",
+			request:     &models.IdentifyRequest{Email: stringPtr("marty@hillvalley.edu"), PhoneNumber: phonePtr("555")},
+			wantPrimary: 2,
+			wantCount:   4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := service.IdentifyContact(tt.request)
+			if err != nil {
+				t.Fatalf("IdentifyContact() error = %v", err)
+			}
+			if response.Contact.PrimaryContactID != tt.wantPrimary {
+				t.Errorf("Expected primary %d, got %d", tt.wantPrimary, response.Contact.PrimaryContactID)
+			}
+			if got := count(); got != tt.wantCount {
+				t.Errorf("Expected %d contacts, got %d", tt.wantCount, got)
+			}
+		})
+	}
+}
+
+func TestIdentityService_SplitIdentityPromotesRemaining(t *testing.T) {
+	service, _ := seedFamilyPhone(t)
+
+	response, err := service.SplitIdentity(1, []int{1})
+	if err != nil {
+		t.Fatalf("SplitIdentity() error = %v", err)
+	}
+	if response.Original.PrimaryContactID != 2 || !reflect.DeepEqual(response.Original.SecondaryContactIDs, []int{3}) {
+		t.Errorf("Expected original identity 2 with secondaries [3], got %+v", response.Original)
+	}
+	if response.Split.PrimaryContactID != 1 {
+		t.Errorf("Expected split identity 1, got %+v", response.Split)
+	}
+}
+
+func TestIdentityService_SplitIdentityRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		primaryID  int
+		contactIDs []int
+		wantErr    error
+	}{
+		{"Unknown primary", 99, []int{2}, ErrContactNotFound},
+		{"Secondary as primary", 2, []int{3}, ErrContactNotFound},
+		{"No contacts", 1, nil, ErrInvalidSplit},
+		{"Contact outside the identity", 1, []int{2, 42}, ErrInvalidSplit},
+		{"Every contact", 1, []int{1, 2, 3}, ErrInvalidSplit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := seedFamilyPhone(t)
+
+			if _, err := service.SplitIdentity(tt.primaryID, tt.contactIDs); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+
+			contact, err := service.GetContact(3)
+			if err != nil {
+				t.Fatalf("GetContact() error = %v", err)
+			}
+			if contact.Contact.PrimaryContactID != 1 {
+				t.Errorf("Expected the identity to be unchanged, got primary %d", contact.Contact.PrimaryContactID)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"bitespeed-identity-reconciliation/internal/models"
+	"context"
+	"time"
+)
+
+// ContactStore is the storage IdentityService runs on. Lookups ignore
+// soft-deleted contacts and return them oldest first, and every change to a
+// contact's link is recorded in its history as part of the same write.
+type ContactStore interface {
+	// WithTx runs fn against a store bound to a single transaction, which
+	// is committed if fn returns nil and rolled back otherwise. Calling
+	// WithTx on a transaction-scoped store runs fn in a savepoint: if fn
+	// fails its writes are undone and the transaction carries on.
+	WithTx(fn func(store ContactStore) error) error
+	// WithContext returns the store with its reads and writes bound to
+	// ctx. Once ctx is done they fail, and a transaction started from the
+	// returned store is rolled back rather than committed.
+	WithContext(ctx context.Context) ContactStore
+	// LockKeys locks keys until the end of the transaction and reports
+	// whether it took any locks. Stores whose transactions already exclude
+	// each other take none, and transactions that lock keys have to lock
+	// everything they touch. Keys are taken in an order every call shares.
+	LockKeys(keys []string) (bool, error)
+	// LockAll waits for every transaction holding key locks and keeps new
+	// ones out until the end of the transaction.
+	LockAll() error
+
+	FindByID(id int) (*models.Contact, error)
+	FindByEmailOrPhone(email, phoneNumber *string) ([]models.Contact, error)
+	FindByLinkedID(linkedID int) ([]models.Contact, error)
+	Create(contact *models.Contact) error
+	UpdateLinkPrecedence(id int, linkedID *int, linkPrecedence string) error
+	DetachContact(id int, linkedID *int, linkPrecedence string) error
+	RestoreLink(id int, linkedID *int, linkPrecedence string) error
+	SoftDelete(id int) error
+	DeleteContacts(ids []int) (int, error)
+	FindEventsByContactID(contactID int) ([]models.ContactEvent, error)
+	FindEverLinked(id int) ([]models.Contact, error)
+
+	CreateTombstones(hashes []string, receiptID string, erasedAt time.Time) error
+	HasTombstone(hashes []string) (bool, error)
+
+	CreateLinkExclusion(contactID, excludedContactID int) error
+	FindLinkExclusions(contactIDs []int) ([][2]int, error)
+
+	CreateBlockedIdentifier(entry *models.BlockedIdentifier) (bool, error)
+	ListBlockedIdentifiers() ([]models.BlockedIdentifier, error)
+	DeleteBlockedIdentifier(id int) (bool, error)
+
+	CreateMerge(merge *models.Merge) error
+	FindMergeByID(id int) (*models.Merge, error)
+	MarkMergeReverted(id int, revertedAt time.Time) error
+	HasEventsAfter(eventID int, contactIDs []int) (bool, error)
+}
+
+// sqlStore is a ContactStore backed by a SQL database.
+type sqlStore struct {
+	*database.ContactRepository
+}
+
+// NewSQLStore returns a ContactStore that reads and writes through repo.
+func NewSQLStore(repo *database.ContactRepository) ContactStore {
+	return sqlStore{repo}
+}
+
+func (s sqlStore) WithTx(fn func(store ContactStore) error) error {
+	return s.ContactRepository.WithTx(func(repo *database.ContactRepository) error {
+		return fn(sqlStore{repo})
+	})
+}
+
+func (s sqlStore) WithContext(ctx context.Context) ContactStore {
+	return sqlStore{s.ContactRepository.WithContext(ctx)}
+}
@@ -0,0 +1,661 @@
+package services
+
+import (
+	"bitespeed-identity-reconciliation/internal/database"
+	"bitespeed-identity-reconciliation/internal/database/dbtest"
+	"bitespeed-identity-reconciliation/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestContactStore_Conformance runs the same checks against every
+// ContactStore, so the in-memory store behaves like the SQL one. The SQL
+// store runs on PostgreSQL when TEST_POSTGRES_DSN is set.
+func TestContactStore_Conformance(t *testing.T) {
+	stores := map[string]func(t *testing.T) ContactStore{
+		"memory": func(t *testing.T) ContactStore { return NewMemoryStore() },
+		"sql": func(t *testing.T) ContactStore {
+			return NewSQLStore(database.NewContactRepository(dbtest.Open(t)))
+		},
+	}
+
+	checks := []struct {
+		name  string
+		check func(t *testing.T, store ContactStore)
+	}{
+		{"Lookups", testStoreLookups},
+		{"Soft delete", testStoreSoftDelete},
+		{"History", testStoreHistory},
+		{"Delete contacts", testStoreDeleteContacts},
+		{"Ever linked", testStoreEverLinked},
+		{"Rollback", testStoreRollback},
+		{"Savepoint", testStoreSavepoint},
+		{"Cancelled context", testStoreCancelledContext},
+		{"Link exclusions", testStoreLinkExclusions},
+		{"Blocklist", testStoreBlocklist},
+		{"Merges", testStoreMerges},
+		{"Tombstones", testStoreTombstones},
+		{"Concurrent creates", testStoreConcurrentCreates},
+	}
+
+	for storeName, newStore := range stores {
+		for _, tt := range checks {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				tt.check(t, newStore(t))
+			})
+		}
+	}
+}
+
+func createContact(t *testing.T, store ContactStore, contact models.Contact) models.Contact {
+	t.Helper()
+	if err := store.Create(&contact); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return contact
+}
+
+func contactIDs(contacts []models.Contact) []int {
+	ids := []int{}
+	for _, contact := range contacts {
+		ids = append(ids, contact.ID)
+	}
+	return ids
+}
+
+func testStoreLookups(t *testing.T, store ContactStore) {
+	first := createContact(t, store, models.Contact{
+		Email:           stringPtr("Doc@HillValley.edu"),
+		NormalizedEmail: stringPtr("doc@hillvalley.edu"),
+		PhoneNumber:     phonePtr("123456"),
+		LinkPrecedence:  "primary",
+	})
+	// Stored without normalized values, so it matches on its raw ones.
+	second := createContact(t, store, models.Contact{
+		Email:          stringPtr("marty@hillvalley.edu"),
+		PhoneNumber:    phonePtr("123456"),
+		LinkedID:       &first.ID,
+		LinkPrecedence: "secondary",
+	})
+	third := createContact(t, store, models.Contact{
+		Email:          stringPtr("doc@hillvalley.edu"),
+		LinkedID:       &first.ID,
+		LinkPrecedence: "secondary",
+	})
+
+	if second.ID <= first.ID || third.ID <= second.ID {
+		t.Fatalf("Expected increasing IDs, got %d, %d, %d", first.ID, second.ID, third.ID)
+	}
+
+	tests := []struct {
+		name  string
+		email *string
+		phone *string
+		want  []int
+	}{
+		{"Normalized email", stringPtr("doc@hillvalley.edu"), nil, []int{first.ID, third.ID}},
+		{"Raw email", stringPtr("marty@hillvalley.edu"), nil, []int{second.ID}},
+		{"Phone", nil, stringPtr("123456"), []int{first.ID, second.ID}},
+		{"Email or phone", stringPtr("marty@hillvalley.edu"), stringPtr("123456"), []int{first.ID, second.ID}},
+		{"Unknown", stringPtr("biff@hillvalley.edu"), nil, []int{}},
+		{"Nothing", nil, nil, []int{}},
+	}
+	for _, tt := range tests {
+		contacts, err := store.FindByEmailOrPhone(tt.email, tt.phone)
+		if err != nil {
+			t.Fatalf("%s: FindByEmailOrPhone() error = %v", tt.name, err)
+		}
+		if got := contactIDs(contacts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected contacts %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	linked, err := store.FindByLinkedID(first.ID)
+	if err != nil {
+		t.Fatalf("FindByLinkedID() error = %v", err)
+	}
+	if got := contactIDs(linked); !reflect.DeepEqual(got, []int{second.ID, third.ID}) {
+		t.Errorf("Expected secondaries %v, got %v", []int{second.ID, third.ID}, got)
+	}
+
+	contact, err := store.FindByID(second.ID)
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if contact == nil || contact.NormalizedEmail == nil || *contact.NormalizedEmail != "marty@hillvalley.edu" ||
+		contact.LinkedID == nil || *contact.LinkedID != first.ID || contact.LinkPrecedence != "secondary" {
+		t.Errorf("Unexpected contact %+v", contact)
+	}
+
+	if contact, err := store.FindByID(99); err != nil || contact != nil {
+		t.Errorf("Expected no contact for an unknown ID, got %+v, %v", contact, err)
+	}
+}
+
+func testStoreSoftDelete(t *testing.T, store ContactStore) {
+	primary := createContact(t, store, models.Contact{Email: stringPtr("doc@hillvalley.edu"), LinkPrecedence: "primary"})
+	secondary := createContact(t, store, models.Contact{
+		Email:          stringPtr("doc@hillvalley.edu"),
+		LinkedID:       &primary.ID,
+		LinkPrecedence: "secondary",
+	})
+
+	if err := store.SoftDelete(secondary.ID); err != nil {
+		t.Fatalf("SoftDelete() error = %v", err)
+	}
+	// Deleted contacts are neither changed nor deleted again.
+	if err := store.UpdateLinkPrecedence(secondary.ID, nil, "primary"); err != nil {
+		t.Fatalf("UpdateLinkPrecedence() error = %v", err)
+	}
+	if err := store.SoftDelete(secondary.ID); err != nil {
+		t.Fatalf("SoftDelete() error = %v", err)
+	}
+
+	if contact, err := store.FindByID(secondary.ID); err != nil || contact != nil {
+		t.Errorf("Expected the deleted contact to be hidden, got %+v, %v", contact, err)
+	}
+	contacts, err := store.FindByEmailOrPhone(stringPtr("doc@hillvalley.edu"), nil)
+	if err != nil {
+		t.Fatalf("FindByEmailOrPhone() error = %v", err)
+	}
+	if got := contactIDs(contacts); !reflect.DeepEqual(got, []int{primary.ID}) {
+		t.Errorf("Expected only contact %d to match, got %v", primary.ID, got)
+	}
+	linked, err := store.FindByLinkedID(primary.ID)
+	if err != nil {
+		t.Fatalf("FindByLinkedID() error = %v", err)
+	}
+	if len(linked) != 0 {
+		t.Errorf("Expected no live secondaries, got %v", contactIDs(linked))
+	}
+
+	events, err := store.FindEventsByContactID(secondary.ID)
+	if err != nil {
+		t.Fatalf("FindEventsByContactID() error = %v", err)
+	}
+	if got := eventTypes(events); !reflect.DeepEqual(got, []string{models.EventCreated, models.EventDeleted}) {
+		t.Errorf("Unexpected history %v", got)
+	}
+}
+
+func eventTypes(events []models.ContactEvent) []string {
+	types := []string{}
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func testStoreHistory(t *testing.T, store ContactStore) {
+	first := createContact(t, store, models.Contact{Email: stringPtr("a@example.com"), LinkPrecedence: "primary"})
+	second := createContact(t, store, models.Contact{Email: stringPtr("b@example.com"), LinkPrecedence: "primary"})
+
+	steps := []func() error{
+		func() error { return store.UpdateLinkPrecedence(second.ID, &first.ID, "secondary") },
+		// Unchanged links are not recorded...
+		func() error { return store.UpdateLinkPrecedence(second.ID, &first.ID, "secondary") },
+		func() error { return store.DetachContact(second.ID, nil, "primary") },
+		// ...unless the event is named.
+		func() error { return store.RestoreLink(second.ID, nil, "primary") },
+		func() error { return store.UpdateLinkPrecedence(second.ID, &first.ID, "secondary") },
+		func() error { return store.UpdateLinkPrecedence(second.ID, nil, "primary") },
+		// Missing contacts are ignored.
+		func() error { return store.UpdateLinkPrecedence(99, nil, "primary") },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("Step %d: %v", i, err)
+		}
+	}
+
+	events, err := store.FindEventsByContactID(second.ID)
+	if err != nil {
+		t.Fatalf("FindEventsByContactID() error = %v", err)
+	}
+	want := []string{
+		models.EventCreated,
+		models.EventDemoted,
+		models.EventSplit,
+		models.EventReverted,
+		models.EventDemoted,
+		models.EventPromoted,
+	}
+	if got := eventTypes(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected events %v, got %v", want, got)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].ID <= events[i-1].ID {
+			t.Errorf("Expected events in ID order, got %d after %d", events[i].ID, events[i-1].ID)
+		}
+	}
+
+	demoted := events[1]
+	if demoted.ContactID != second.ID ||
+		demoted.PreviousLinkedID != nil || demoted.PreviousLinkPrecedence == nil || *demoted.PreviousLinkPrecedence != "primary" ||
+		demoted.LinkedID == nil || *demoted.LinkedID != first.ID || demoted.LinkPrecedence == nil || *demoted.LinkPrecedence != "secondary" {
+		t.Errorf("Unexpected demotion event %+v", demoted)
+	}
+
+	if events, err := store.FindEventsByContactID(99); err != nil || events == nil || len(events) != 0 {
+		t.Errorf("Expected an empty history for an unknown contact, got %v, %v", events, err)
+	}
+}
+
+func testStoreDeleteContacts(t *testing.T, store ContactStore) {
+	primary := createContact(t, store, models.Contact{Email: stringPtr("doc@hillvalley.edu"), LinkPrecedence: "primary"})
+	secondary := createContact(t, store, models.Contact{
+		Email:          stringPtr("emmett@hillvalley.edu"),
+		LinkedID:       &primary.ID,
+		LinkPrecedence: "secondary",
+	})
+	deleted := createContact(t, store, models.Contact{
+		Email:          stringPtr("brown@hillvalley.edu"),
+		LinkedID:       &primary.ID,
+		LinkPrecedence: "secondary",
+	})
+	other := createContact(t, store, models.Contact{Email: stringPtr("biff@hillvalley.edu"), LinkPrecedence: "primary"})
+
+	if err := store.SoftDelete(deleted.ID); err != nil {
+		t.Fatalf("SoftDelete() error = %v", err)
+	}
+
+	removed, err := store.DeleteContacts([]int{primary.ID, secondary.ID, deleted.ID, 99})
+	if err != nil {
+		t.Fatalf("DeleteContacts() error = %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 contacts to be removed, including the soft-deleted one, got %d", removed)
+	}
+
+	for _, id := range []int{primary.ID, secondary.ID} {
+		if contact, err := store.FindByID(id); err != nil || contact != nil {
+			t.Errorf("Expected contact %d to be gone, got %+v, %v", id, contact, err)
+		}
+		events, err := store.FindEventsByContactID(id)
+		if err != nil {
+			t.Fatalf("FindEventsByContactID() error = %v", err)
+		}
+		if len(events) == 0 || events[len(events)-1].Type != models.EventErased {
+			t.Errorf("Expected contact %d to end with an erased event, got %v", id, eventTypes(events))
+		}
+	}
+	if contact, err := store.FindByID(other.ID); err != nil || contact == nil {
+		t.Errorf("Expected contact %d to survive, got %+v, %v", other.ID, contact, err)
+	}
+}
+
+func testStoreEverLinked(t *testing.T, store ContactStore) {
+	primary := createContact(t, store, models.Contact{Email: stringPtr("doc@hillvalley.edu"), LinkPrecedence: "primary"})
+	promoted := createContact(t, store, models.Contact{
+		Email:          stringPtr("emmett@hillvalley.edu"),
+		LinkedID:       &primary.ID,
+		LinkPrecedence: "secondary",
+	})
+	deleted := createContact(t, store, models.Contact{
+		Email:          stringPtr("brown@hillvalley.edu"),
+		LinkedID:       &primary.ID,
+		LinkPrecedence: "secondary",
+	})
+	other := createContact(t, store, models.Contact{Email: stringPtr("biff@hillvalley.edu"), LinkPrecedence: "primary"})
+
+	for _, id := range []int{deleted.ID, primary.ID} {
+		if err := store.SoftDelete(id); err != nil {
+			t.Fatalf("SoftDelete() error = %v", err)
+		}
+	}
+	if err := store.UpdateLinkPrecedence(promoted.ID, nil, "primary"); err != nil {
+		t.Fatalf("UpdateLinkPrecedence() error = %v", err)
+	}
+
+	// Only the history still ties the promoted contact to its old primary.
+	tests := []struct {
+		id   int
+		want []int
+	}{
+		{promoted.ID, []int{primary.ID}},
+		{primary.ID, []int{promoted.ID, deleted.ID}},
+		{other.ID, []int{}},
+	}
+	for _, tt := range tests {
+		contacts, err := store.FindEverLinked(tt.id)
+		if err != nil {
+			t.Fatalf("FindEverLinked() error = %v", err)
+		}
+		if got := contactIDs(contacts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FindEverLinked(%d): expected %v, got %v", tt.id, tt.want, got)
+		}
+	}
+	contacts, _ := store.FindEverLinked(promoted.ID)
+	if len(contacts) != 1 || contacts[0].DeletedAt == nil || contacts[0].NormalizedEmail == nil {
+		t.Errorf("Expected the soft-deleted primary with its identifiers, got %+v", contacts)
+	}
+}
+
+func testStoreRollback(t *testing.T, store ContactStore) {
+	primary := createContact(t, store, models.Contact{Email: stringPtr("doc@hillvalley.edu"), LinkPrecedence: "primary"})
+
+	injected := errors.New("injected failure")
+	err := store.WithTx(func(tx ContactStore) error {
+		if err := tx.Create(&models.Contact{Email: stringPtr("marty@hillvalley.edu"), LinkPrecedence: "primary"}); err != nil {
+			return err
+		}
+		if err := tx.SoftDelete(primary.ID); err != nil {
+			return err
+		}
+		if err := tx.CreateLinkExclusion(primary.ID, 99); err != nil {
+			return err
+		}
+		// A failed savepoint fails the whole transaction when its error is
+		// passed on.
+		return tx.WithTx(func(tx ContactStore) error {
+			if _, err := tx.CreateBlockedIdentifier(&models.BlockedIdentifier{Type: models.IdentifierEmail, Value: "doc@hillvalley.edu"}); err != nil {
+				return err
+			}
+			if err := tx.CreateTombstones([]string{"hash"}, "receipt", time.Now()); err != nil {
+				return err
+			}
+			return injected
+		})
+	})
+	if !errors.Is(err, injected) {
+		t.Fatalf("Expected the injected error, got %v", err)
+	}
+
+	if contacts, _ := store.FindByEmailOrPhone(stringPtr("marty@hillvalley.edu"), nil); len(contacts) != 0 {
+		t.Errorf("Expected the created contact to be rolled back, got %v", contactIDs(contacts))
+	}
+	if contact, _ := store.FindByID(primary.ID); contact == nil {
+		t.Error("Expected the soft delete to be rolled back")
+	}
+	if events, _ := store.FindEventsByContactID(primary.ID); len(events) != 1 {
+		t.Errorf("Expected only the created event to survive, got %v", eventTypes(events))
+	}
+	if exclusions, _ := store.FindLinkExclusions([]int{primary.ID, 99}); len(exclusions) != 0 {
+		t.Errorf("Expected the exclusion to be rolled back, got %v", exclusions)
+	}
+	if entries, _ := store.ListBlockedIdentifiers(); len(entries) != 0 {
+		t.Errorf("Expected the blocklist entry to be rolled back, got %v", entries)
+	}
+	if found, _ := store.HasTombstone([]string{"hash"}); found {
+		t.Error("Expected the tombstone to be rolled back")
+	}
+
+	// A panic rolls back too, and leaves the store usable.
+	func() {
+		defer func() { recover() }()
+		store.WithTx(func(tx ContactStore) error {
+			tx.SoftDelete(primary.ID)
+			panic("injected panic")
+		})
+	}()
+	if contact, err := store.FindByID(primary.ID); err != nil || contact == nil {
+		t.Errorf("Expected the soft delete to be rolled back after a panic, got %+v, %v", contact, err)
+	}
+}
+
+func testStoreSavepoint(t *testing.T, store ContactStore) {
+	injected := errors.New("injected failure")
+	err := store.WithTx(func(tx ContactStore) error {
+		if err := tx.Create(&models.Contact{Email: stringPtr("doc@hillvalley.edu"), LinkPrecedence: "primary"}); err != nil {
+			return err
+		}
+
+		err := tx.WithTx(func(sp ContactStore) error {
+			if err := sp.Create(&models.Contact{Email: stringPtr("marty@hillvalley.edu"), LinkPrecedence: "primary"}); err != nil {
+				return err
+			}
+			if _, err := sp.CreateBlockedIdentifier(&models.BlockedIdentifier{Type: models.IdentifierEmail, Value: "doc@hillvalley.edu"}); err != nil {
+				return err
+			}
+			return injected
+		})
+		if !errors.Is(err, injected) {
+			t.Errorf("Expected the injected error from the savepoint, got %v", err)
+		}
+
+		return tx.WithTx(func(sp ContactStore) error {
+			return sp.Create(&models.Contact{Email: stringPtr("biff@hillvalley.edu"), LinkPrecedence: "primary"})
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+
+	for email, want := range map[string]int{
+		"doc@hillvalley.edu":   1,
+		"marty@hillvalley.edu": 0,
+		"biff@hillvalley.edu":  1,
+	} {
+		contacts, err := store.FindByEmailOrPhone(stringPtr(email), nil)
+		if err != nil {
+			t.Fatalf("FindByEmailOrPhone() error = %v", err)
+		}
+		if len(contacts) != want {
+			t.Errorf("Expected %d contacts for %s, got %d", want, email, len(contacts))
+		}
+	}
+	if entries, _ := store.ListBlockedIdentifiers(); len(entries) != 0 {
+		t.Errorf("Expected the savepoint's blocklist entry to be undone, got %v", entries)
+	}
+}
+
+func testStoreCancelledContext(t *testing.T, store ContactStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := store.WithContext(ctx).WithTx(func(tx ContactStore) error {
+		if err := tx.Create(&models.Contact{Email: stringPtr("doc@hillvalley.edu"), LinkPrecedence: "primary"}); err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, sql.ErrTxDone) {
+		t.Fatalf("Expected the transaction to fail once its context was cancelled, got %v", err)
+	}
+
+	if contacts, _ := store.FindByEmailOrPhone(stringPtr("doc@hillvalley.edu"), nil); len(contacts) != 0 {
+		t.Errorf("Expected the contact to be rolled back, got %v", contactIDs(contacts))
+	}
+	// A store bound to a cancelled context does not start a transaction.
+	err = store.WithContext(ctx).WithTx(func(tx ContactStore) error {
+		return tx.Create(&models.Contact{Email: stringPtr("marty@hillvalley.edu"), LinkPrecedence: "primary"})
+	})
+	if err == nil {
+		t.Error("Expected an error from a cancelled context")
+	}
+	if contacts, _ := store.FindByEmailOrPhone(stringPtr("marty@hillvalley.edu"), nil); len(contacts) != 0 {
+		t.Errorf("Expected no contact to be written, got %v", contactIDs(contacts))
+	}
+}
+
+func testStoreLinkExclusions(t *testing.T, store ContactStore) {
+	for _, exclusion := range [][2]int{{1, 2}, {1, 2}, {3, 1}, {4, 5}} {
+		if err := store.CreateLinkExclusion(exclusion[0], exclusion[1]); err != nil {
+			t.Fatalf("CreateLinkExclusion() error = %v", err)
+		}
+	}
+
+	exclusions, err := store.FindLinkExclusions([]int{1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("FindLinkExclusions() error = %v", err)
+	}
+	got := map[[2]int]bool{}
+	for _, exclusion := range exclusions {
+		got[exclusion] = true
+	}
+	want := map[[2]int]bool{{1, 2}: true, {3, 1}: true}
+	if len(exclusions) != len(want) || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected exclusions %v, got %v", want, exclusions)
+	}
+
+	if exclusions, err := store.FindLinkExclusions([]int{1}); err != nil || len(exclusions) != 0 {
+		t.Errorf("Expected no exclusions for a single contact, got %v, %v", exclusions, err)
+	}
+}
+
+func testStoreBlocklist(t *testing.T, store ContactStore) {
+	entries := []*models.BlockedIdentifier{
+		{Type: models.IdentifierPhone, Value: "5550000000", Reason: stringPtr("front desk")},
+		{Type: models.IdentifierEmail, Value: "5550000000"},
+	}
+	for _, entry := range entries {
+		created, err := store.CreateBlockedIdentifier(entry)
+		if err != nil || !created {
+			t.Fatalf("CreateBlockedIdentifier() = %v, %v", created, err)
+		}
+	}
+	if entries[1].ID <= entries[0].ID || entries[0].CreatedAt.IsZero() {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	created, err := store.CreateBlockedIdentifier(&models.BlockedIdentifier{Type: models.IdentifierPhone, Value: "5550000000"})
+	if err != nil || created {
+		t.Errorf("Expected a duplicate entry to be ignored, got %v, %v", created, err)
+	}
+
+	deleted, err := store.DeleteBlockedIdentifier(entries[0].ID)
+	if err != nil || !deleted {
+		t.Fatalf("DeleteBlockedIdentifier() = %v, %v", deleted, err)
+	}
+	if deleted, err := store.DeleteBlockedIdentifier(entries[0].ID); err != nil || deleted {
+		t.Errorf("Expected a second delete to find nothing, got %v, %v", deleted, err)
+	}
+
+	listed, err := store.ListBlockedIdentifiers()
+	if err != nil {
+		t.Fatalf("ListBlockedIdentifiers() error = %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != entries[1].ID || listed[0].Type != models.IdentifierEmail {
+		t.Errorf("Unexpected blocklist %+v", listed)
+	}
+}
+
+func testStoreMerges(t *testing.T, store ContactStore) {
+	first := createContact(t, store, models.Contact{Email: stringPtr("a@example.com"), LinkPrecedence: "primary"})
+	second := createContact(t, store, models.Contact{Email: stringPtr("b@example.com"), LinkPrecedence: "primary"})
+	if err := store.UpdateLinkPrecedence(second.ID, &first.ID, "secondary"); err != nil {
+		t.Fatalf("UpdateLinkPrecedence() error = %v", err)
+	}
+
+	merge := &models.Merge{
+		PrimaryContactID: first.ID,
+		TriggeredBy:      "jane@support",
+		Contacts: []models.MergeContact{{
+			ContactID:              second.ID,
+			PreviousLinkPrecedence: stringPtr("primary"),
+			LinkedID:               &first.ID,
+			LinkPrecedence:         "secondary",
+		}},
+	}
+	if err := store.CreateMerge(merge); err != nil {
+		t.Fatalf("CreateMerge() error = %v", err)
+	}
+
+	events, err := store.FindEventsByContactID(second.ID)
+	if err != nil {
+		t.Fatalf("FindEventsByContactID() error = %v", err)
+	}
+	if merge.ID == 0 || merge.LastEventID != events[len(events)-1].ID {
+		t.Errorf("Expected the merge to mark event %d, got %+v", events[len(events)-1].ID, merge)
+	}
+
+	if found, err := store.HasEventsAfter(merge.LastEventID, []int{first.ID, second.ID}); err != nil || found {
+		t.Errorf("Expected no events after the merge, got %v, %v", found, err)
+	}
+	// A contact linking to the winner depends on the merge.
+	createContact(t, store, models.Contact{Email: stringPtr("c@example.com"), LinkedID: &first.ID, LinkPrecedence: "secondary"})
+	if found, err := store.HasEventsAfter(merge.LastEventID, []int{first.ID}); err != nil || !found {
+		t.Errorf("Expected an event after the merge, got %v, %v", found, err)
+	}
+	if found, err := store.HasEventsAfter(merge.LastEventID, []int{second.ID}); err != nil || found {
+		t.Errorf("Expected no event concerning contact %d, got %v, %v", second.ID, found, err)
+	}
+
+	revertedAt := time.Now()
+	if err := store.MarkMergeReverted(merge.ID, revertedAt); err != nil {
+		t.Fatalf("MarkMergeReverted() error = %v", err)
+	}
+	stored, err := store.FindMergeByID(merge.ID)
+	if err != nil {
+		t.Fatalf("FindMergeByID() error = %v", err)
+	}
+	if stored == nil || stored.TriggeredBy != "jane@support" || stored.RevertedAt == nil ||
+		!reflect.DeepEqual(stored.Contacts, merge.Contacts) {
+		t.Errorf("Unexpected merge %+v", stored)
+	}
+
+	if stored, err := store.FindMergeByID(99); err != nil || stored != nil {
+		t.Errorf("Expected no merge for an unknown ID, got %+v, %v", stored, err)
+	}
+}
+
+func testStoreTombstones(t *testing.T, store ContactStore) {
+	if err := store.CreateTombstones([]string{"a", "b"}, "receipt", time.Now()); err != nil {
+		t.Fatalf("CreateTombstones() error = %v", err)
+	}
+	// Existing hashes are left alone.
+	if err := store.CreateTombstones([]string{"b"}, "another receipt", time.Now()); err != nil {
+		t.Fatalf("CreateTombstones() error = %v", err)
+	}
+
+	tests := []struct {
+		hashes []string
+		want   bool
+	}{
+		{[]string{"a"}, true},
+		{[]string{"c", "b"}, true},
+		{[]string{"c"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if found, err := store.HasTombstone(tt.hashes); err != nil || found != tt.want {
+			t.Errorf("HasTombstone(%v): expected %v, got %v, %v", tt.hashes, tt.want, found, err)
+		}
+	}
+}
+
+func testStoreConcurrentCreates(t *testing.T, store ContactStore) {
+	const writers = 20
+
+	var wg sync.WaitGroup
+	ids := make(chan int, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.WithTx(func(tx ContactStore) error {
+				contact := &models.Contact{Email: stringPtr("doc@hillvalley.edu"), LinkPrecedence: "primary"}
+				if err := tx.Create(contact); err != nil {
+					return err
+				}
+				ids <- contact.ID
+				return nil
+			})
+			if err != nil {
+				t.Errorf("WithTx() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := map[int]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("ID %d was assigned twice", id)
+		}
+		seen[id] = true
+	}
+
+	contacts, err := store.FindByEmailOrPhone(stringPtr("doc@hillvalley.edu"), nil)
+	if err != nil {
+		t.Fatalf("FindByEmailOrPhone() error = %v", err)
+	}
+	if len(contacts) != writers {
+		t.Errorf("Expected %d contacts, got %d", writers, len(contacts))
+	}
+}
@@ -0,0 +1,212 @@
+// Package validation checks requests at the edge of the API, before they
+// reach the service, and reports every problem with a request at once.
+package validation
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// MaxBodyBytes is the largest body accepted for a single request.
+	MaxBodyBytes = 16 << 10
+
+	// MaxEmailLength is the longest email address SMTP can deliver to
+	// (RFC 5321), and MaxLocalPartLength the longest part before the "@".
+	MaxEmailLength     = 254
+	MaxLocalPartLength = 64
+	maxLabelLength     = 63
+
+	// MinPhoneDigits and MaxPhoneDigits bound the digits of a phone number,
+	// country code included. Short codes have three; E.164 allows fifteen.
+	MinPhoneDigits = 3
+	MaxPhoneDigits = 15
+	// MaxPhoneLength bounds a phone number as written, with its spaces,
+	// dashes and parentheses.
+	MaxPhoneLength = 32
+)
+
+// Errors lists every problem found in a request. It is a validation error
+// coded invalid_request, with one FieldError per problem.
+type Errors []utils.FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, field := range e {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e Errors) Kind() utils.Kind                { return utils.KindValidation }
+func (e Errors) Code() string                    { return "invalid_request" }
+func (e Errors) FieldErrors() []utils.FieldError { return e }
+
+func (e *Errors) add(field, message string) {
+	*e = append(*e, utils.FieldError{Field: field, Message: message})
+}
+
+// Decode reads the JSON body of r into dest. Bodies over limit bytes,
+// unknown fields and anything after the JSON value are rejected.
+func Decode(w http.ResponseWriter, r *http.Request, dest any, limit int64) error {
+	return decodeStrict(http.MaxBytesReader(w, r.Body, limit), dest)
+}
+
+// Unmarshal is Decode for a value that has already been read, such as one
+// request of a batch.
+func Unmarshal(data []byte, dest any) error {
+	return decodeStrict(bytes.NewReader(data), dest)
+}
+
+func decodeStrict(r io.Reader, dest any) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dest); err != nil {
+		return utils.JSONError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return utils.JSONError(errors.New("body must hold a single JSON value"))
+	}
+	return nil
+}
+
+// IdentifyRequest checks the identifiers of req. Blank identifiers count as
+// missing, and at least one must be present.
+func IdentifyRequest(req *models.IdentifyRequest) error {
+	var errs Errors
+
+	email := ""
+	if req.Email != nil {
+		email = strings.TrimSpace(*req.Email)
+	}
+	phone := ""
+	if req.PhoneNumber != nil {
+		phone = strings.TrimSpace(string(*req.PhoneNumber))
+	}
+
+	if email == "" && phone == "" {
+		errs.add("email", "required when phoneNumber is missing")
+		errs.add("phoneNumber", "required when email is missing")
+	}
+	if email != "" {
+		if problem := Email(email); problem != "" {
+			errs.add("email", problem)
+		}
+	}
+	if phone != "" {
+		if problem := Phone(phone); problem != "" {
+			errs.add("phoneNumber", problem)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Email checks the syntax of an address and returns what is wrong with it,
+// or "" if nothing is. It accepts the dot-atom form of RFC 5322, which
+// covers every address in practical use, and requires a domain with at
+// least two labels. Quoted local parts and IP literals are rejected.
+func Email(email string) string {
+	if len(email) > MaxEmailLength {
+		return fmt.Sprintf("must be at most %d characters", MaxEmailLength)
+	}
+
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return "must contain @"
+	}
+	local, domain := email[:at], email[at+1:]
+
+	switch {
+	case local == "":
+		return "must have a local part before @"
+	case len(local) > MaxLocalPartLength:
+		return fmt.Sprintf("local part must be at most %d characters", MaxLocalPartLength)
+	case !dotAtom(local, isAtext):
+		return "local part has an invalid character or misplaced dot"
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "domain must contain a dot"
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > maxLabelLength ||
+			label[0] == '-' || label[len(label)-1] == '-' || !allBytes(label, isLabelChar) {
+			return fmt.Sprintf("domain %q is not a valid host name", domain)
+		}
+	}
+	return ""
+}
+
+// Phone checks a phone number as written and returns what is wrong with it,
+// or "" if nothing is. It may start with "+" and hold spaces, dashes, dots
+// and parentheses between its digits.
+func Phone(phone string) string {
+	if len(phone) > MaxPhoneLength {
+		return fmt.Sprintf("must be at most %d characters", MaxPhoneLength)
+	}
+
+	number := strings.TrimPrefix(phone, "+")
+	if number == phone {
+		number = strings.TrimPrefix(phone, "00")
+	}
+
+	digits := 0
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return fmt.Sprintf("has an invalid character %q", r)
+		}
+	}
+	if digits < MinPhoneDigits || digits > MaxPhoneDigits {
+		return fmt.Sprintf("must have between %d and %d digits", MinPhoneDigits, MaxPhoneDigits)
+	}
+	return ""
+}
+
+// dotAtom reports whether s is runs of valid characters joined by single
+// dots.
+func dotAtom(s string, valid func(c byte) bool) bool {
+	for _, atom := range strings.Split(s, ".") {
+		if atom == "" || !allBytes(atom, valid) {
+			return false
+		}
+	}
+	return true
+}
+
+func allBytes(s string, valid func(c byte) bool) bool {
+	for i := 0; i < len(s); i++ {
+		if !valid(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isAtext reports whether c may appear in an RFC 5322 atom.
+func isAtext(c byte) bool {
+	return isAlnum(c) || strings.IndexByte("!#$%&'*+/=?^_`{|}~-", c) >= 0
+}
+
+func isLabelChar(c byte) bool {
+	return isAlnum(c) || c == '-'
+}
@@ -0,0 +1,157 @@
+package validation
+
+import (
+	"bitespeed-identity-reconciliation/internal/models"
+	"bitespeed-identity-reconciliation/pkg/utils"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		valid bool
+	}{
+		{"lorraine@hillvalley.edu", true},
+		{"Marty.McFly+delorean@hill-valley.example.com", true},
+		{"o'brien!#$%&*/=?^_`{|}~@example.co.uk", true},
+		{"doc", false},
+		{"@hillvalley.edu", false},
+		{"doc@", false},
+		{"doc@localhost", false},
+		{".doc@hillvalley.edu", false},
+		{"doc.@hillvalley.edu", false},
+		{"doc..brown@hillvalley.edu", false},
+		{"doc brown@hillvalley.edu", false},
+		{`"doc"@hillvalley.edu`, false},
+		{"doc@hill_valley.edu", false},
+		{"doc@-hillvalley.edu", false},
+		{"doc@hillvalley..edu", false},
+		{"doc@[127.0.0.1]", false},
+		{strings.Repeat("a", 65) + "@hillvalley.edu", false},
+		{"doc@" + strings.Repeat("a", 64) + ".edu", false},
+		{strings.Repeat("a", 64) + "@" + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 63) + ".edu", false},
+	}
+
+	for _, tt := range tests {
+		if got := Email(tt.email); (got == "") != tt.valid {
+			t.Errorf("Email(%q) = %q, expected valid %v", tt.email, got, tt.valid)
+		}
+	}
+}
+
+func TestPhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		valid bool
+	}{
+		{"123456", true},
+		{"555", true},
+		{"+1 (555) 010-0000", true},
+		{"0044 20.7946.0000", true},
+		{"12", false},
+		{"+12", false},
+		{"1234567890123456", false},
+		{"555-CALL-NOW", false},
+		{"+1 555 0100 ext 12", false},
+		{strings.Repeat("1-", 17), false},
+	}
+
+	for _, tt := range tests {
+		if got := Phone(tt.phone); (got == "") != tt.valid {
+			t.Errorf("Phone(%q) = %q, expected valid %v", tt.phone, got, tt.valid)
+		}
+	}
+}
+
+func TestIdentifyRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    models.IdentifyRequest
+		fields []string
+	}{
+		{"Email only", models.IdentifyRequest{Email: stringPtr("doc@hillvalley.edu")}, nil},
+		{"Phone only", models.IdentifyRequest{PhoneNumber: phonePtr("123456")}, nil},
+		{"Nothing", models.IdentifyRequest{}, []string{"email", "phoneNumber"}},
+		{"Blank", models.IdentifyRequest{Email: stringPtr("  "), PhoneNumber: phonePtr("")}, []string{"email", "phoneNumber"}},
+		{"Both invalid", models.IdentifyRequest{Email: stringPtr("doc"), PhoneNumber: phonePtr("call me")}, []string{"email", "phoneNumber"}},
+		{"Email invalid", models.IdentifyRequest{Email: stringPtr("doc@"), PhoneNumber: phonePtr("123456")}, []string{"email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := IdentifyRequest(&tt.req)
+			if tt.fields == nil {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected Errors, got %v", err)
+			}
+			var fields []string
+			for _, field := range errs {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("Expected errors for %v, got %v", tt.fields, errs)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		code  string
+		field string
+	}{
+		{"Valid", `{"email": "doc@hillvalley.edu", "phoneNumber": 123456}`, "", ""},
+		{"Unknown field", `{"email": "doc@hillvalley.edu", "name": "Doc"}`, "invalid_json", "name"},
+		{"Wrong type", `{"email": ["doc@hillvalley.edu"]}`, "invalid_json", "email"},
+		{"Trailing data", `{"email": "doc@hillvalley.edu"} {}`, "invalid_json", ""},
+		{"Too large", `{"email": "` + strings.Repeat("a", MaxBodyBytes) + `"}`, "request_too_large", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/identify", strings.NewReader(tt.body))
+			var req models.IdentifyRequest
+			err := Decode(httptest.NewRecorder(), r, &req, MaxBodyBytes)
+
+			if tt.code == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			var classified utils.ClassifiedError
+			if !errors.As(err, &classified) || classified.Code() != tt.code {
+				t.Fatalf("Expected code %s, got %v", tt.code, err)
+			}
+			if tt.field != "" {
+				var fields utils.FieldErrors
+				if !errors.As(err, &fields) || len(fields.FieldErrors()) != 1 || fields.FieldErrors()[0].Field != tt.field {
+					t.Errorf("Expected the error to name %s, got %v", tt.field, err)
+				}
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func phonePtr(s string) *models.PhoneNumber {
+	p := models.PhoneNumber(s)
+	return &p
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Kind says whose fault an error is, and so which status code it gets.
+type Kind int
+
+const (
+	// KindInternal is a failure on the server's side, such as a database
+	// error. It is the kind of every error that does not say otherwise.
+	KindInternal Kind = iota
+	// KindValidation is a request that cannot succeed as sent.
+	KindValidation
+	// KindNotFound is a request for something that does not exist.
+	KindNotFound
+	// KindConflict is a request the current state does not allow.
+	KindConflict
+	// KindTooLarge is a request body over the size limit.
+	KindTooLarge
+	// KindUnavailable is a request the server cannot take on right now,
+	// such as one arriving while it shuts down.
+	KindUnavailable
+)
+
+// Status returns the HTTP status code for errors of kind k.
+func (k Kind) Status() int {
+	switch k {
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ClassifiedError is implemented by errors that know their Kind and carry a
+// stable, machine-readable code for clients to match on.
+type ClassifiedError interface {
+	error
+	Kind() Kind
+	Code() string
+}
+
+// FieldError is a problem with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is implemented by validation errors that name the fields at
+// fault.
+type FieldErrors interface {
+	FieldErrors() []FieldError
+}
+
+// statusCodes are the codes of errors that carry none of their own.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return "internal_error"
+	}
+	return "invalid_request"
+}
+
+// JSONError classifies an error from decoding a request body: a validation
+// error coded invalid_json, naming the field at fault where the decoder
+// does, or request_too_large for a body cut off by http.MaxBytesReader.
+// It returns nil for a nil err.
+func JSONError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &jsonError{
+			err:     err,
+			message: fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit),
+			kind:    KindTooLarge,
+			code:    "request_too_large",
+		}
+	}
+
+	decodeErr := &jsonError{err: err, message: err.Error(), kind: KindValidation, code: "invalid_json"}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		decodeErr.fields = []FieldError{{Field: typeErr.Field, Message: "must be " + typeErr.Type.String()}}
+	}
+	// The decoder reports unknown fields with a plain error.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		decodeErr.message = "unknown field " + field
+		decodeErr.fields = []FieldError{{Field: strings.Trim(field, `"`), Message: "unknown field"}}
+	}
+	return decodeErr
+}
+
+// jsonError is a request body that could not be decoded.
+type jsonError struct {
+	err     error
+	message string
+	kind    Kind
+	code    string
+	fields  []FieldError
+}
+
+func (e *jsonError) Error() string             { return e.message }
+func (e *jsonError) Unwrap() error             { return e.err }
+func (e *jsonError) Kind() Kind                { return e.kind }
+func (e *jsonError) Code() string              { return e.code }
+func (e *jsonError) FieldErrors() []FieldError { return e.fields }
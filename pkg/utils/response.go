@@ -1,29 +1,83 @@
 package utils
 
 import (
-	"net/http"
 	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
 )
 
+// ErrorResponse is the body of every error response. Code is stable and
+// meant for programs; Error and Message are meant for people. Details lists
+// the fields at fault when a request fails validation.
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+	Error   string       `json:"error"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
 }
 
 func WriteJSON(w http.ResponseWriter, status int, data interface{}) error {
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(status)
-    return json.NewEncoder(w).Encode(data)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(data)
 }
 
+// WriteError writes err as an ErrorResponse with the given status. err may
+// be nil when the status says it all.
 func WriteError(w http.ResponseWriter, status int, err error, message string) {
-    errorResp := ErrorResponse{
-        Error:   err.Error(),
-        Message: message,
-    }
-    WriteJSON(w, status, errorResp)
+	WriteJSON(w, status, NewErrorResponse(status, err, message))
+}
+
+// RespondError writes err as an ErrorResponse with the status of its Kind:
+// 400 for validation errors, 404 for not-found, 409 for conflicts and 500
+// for everything else, including errors that carry no Kind.
+func RespondError(w http.ResponseWriter, err error, message string) {
+	WriteError(w, ErrorStatus(err), err, message)
+}
+
+// ErrorStatus returns the HTTP status code for err.
+func ErrorStatus(err error) int {
+	var classified ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Kind().Status()
+	}
+	return http.StatusInternalServerError
 }
 
+// NewErrorResponse describes err for a client answered with status. The
+// text of server errors is logged rather than returned, since it can hold
+// details of the database.
+func NewErrorResponse(status int, err error, message string) ErrorResponse {
+	response := ErrorResponse{
+		Code:    statusCode(status),
+		Message: message,
+	}
+
+	switch {
+	case err == nil:
+		response.Error = http.StatusText(status)
+	case status >= http.StatusInternalServerError:
+		log.Printf("%s: %v", message, err)
+		response.Error = http.StatusText(status)
+	default:
+		response.Error = err.Error()
+	}
+
+	var classified ClassifiedError
+	if errors.As(err, &classified) {
+		response.Code = classified.Code()
+	}
+	var fields FieldErrors
+	if errors.As(err, &fields) {
+		response.Details = fields.FieldErrors()
+	}
+
+	return response
+}
+
+// ParseJSON decodes the request body into dest. Its errors are classified
+// by JSONError.
 func ParseJSON(r *http.Request, dest interface{}) error {
-    return json.NewDecoder(r.Body).Decode(dest)
-}
\ No newline at end of file
+	return JSONError(json.NewDecoder(r.Body).Decode(dest))
+}
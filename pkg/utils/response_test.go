@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -91,3 +95,97 @@ func TestParseJSON(t *testing.T) {
 		})
 	}
 }
+
+type testClassifiedError struct{}
+
+func (testClassifiedError) Error() string { return "contact not found" }
+func (testClassifiedError) Kind() Kind    { return KindNotFound }
+func (testClassifiedError) Code() string  { return "contact_not_found" }
+
+type testValidationError struct{}
+
+func (testValidationError) Error() string { return "invalid request" }
+func (testValidationError) Kind() Kind    { return KindValidation }
+func (testValidationError) Code() string  { return "invalid_request" }
+func (testValidationError) FieldErrors() []FieldError {
+	return []FieldError{{Field: "email", Message: "must contain @"}}
+}
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ErrorResponse
+		status   int
+	}{
+		{
+			name:     "Classified error",
+			err:      fmt.Errorf("%w: contact 42", testClassifiedError{}),
+			status:   http.StatusNotFound,
+			expected: ErrorResponse{Error: "contact not found: contact 42", Code: "contact_not_found", Message: "Failed"},
+		},
+		{
+			name:   "Validation error with fields",
+			err:    testValidationError{},
+			status: http.StatusBadRequest,
+			expected: ErrorResponse{Error: "invalid request", Code: "invalid_request", Message: "Failed",
+				Details: []FieldError{{Field: "email", Message: "must contain @"}}},
+		},
+		{
+			name:     "Unclassified error is internal and hidden",
+			err:      errors.New("pq: relation \"contacts\" does not exist"),
+			status:   http.StatusInternalServerError,
+			expected: ErrorResponse{Error: "Internal Server Error", Code: "internal_error", Message: "Failed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			RespondError(w, tt.err, "Failed")
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+			var got ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWriteErrorWithoutError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteError(w, http.StatusMethodNotAllowed, nil, "Use POST")
+
+	var got ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := ErrorResponse{Error: "Method Not Allowed", Code: "method_not_allowed", Message: "Use POST"}
+	if w.Code != http.StatusMethodNotAllowed || !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %d %+v, got %d %+v", http.StatusMethodNotAllowed, expected, w.Code, got)
+	}
+}
+
+func TestParseJSONFieldErrors(t *testing.T) {
+	req := httptest.NewRequest("POST", "/test", strings.NewReader(`{"value": "one"}`))
+
+	var result struct {
+		Value int `json:"value"`
+	}
+	err := ParseJSON(req, &result)
+
+	var classified ClassifiedError
+	if !errors.As(err, &classified) || classified.Code() != "invalid_json" || classified.Kind() != KindValidation {
+		t.Fatalf("Expected an invalid_json validation error, got %v", err)
+	}
+	var fields FieldErrors
+	if !errors.As(err, &fields) || len(fields.FieldErrors()) != 1 || fields.FieldErrors()[0].Field != "value" {
+		t.Errorf("Expected the error to name the value field, got %v", err)
+	}
+}